@@ -2,6 +2,7 @@ package benchmark
 
 import (
 	"github.com/sonh/qs"
+	"net/url"
 	"testing"
 )
 
@@ -22,9 +23,8 @@ type Primitive struct {
 	Float64 float64
 }
 
-func BenchmarkEncodePrimitive(b *testing.B) {
-	encoder := qs.NewEncoder()
-	s := Primitive{
+func newPrimitive() Primitive {
+	return Primitive{
 		String: "abc",
 		Bool:   true,
 		Int:    12,
@@ -38,6 +38,11 @@ func BenchmarkEncodePrimitive(b *testing.B) {
 		Uint32: uint32(32),
 		Uint64: uint64(64),
 	}
+}
+
+func BenchmarkEncodePrimitive(b *testing.B) {
+	encoder := qs.NewEncoder()
+	s := newPrimitive()
 	b.ReportAllocs()
 	for n := 0; n < b.N; n++ {
 		if _, err := encoder.Values(&s); err != nil {
@@ -45,3 +50,55 @@ func BenchmarkEncodePrimitive(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkEncodeToValues(b *testing.B) {
+	encoder := qs.NewEncoder()
+	s := newPrimitive()
+	values := make(url.Values)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		for key := range values {
+			values[key] = values[key][:0]
+		}
+		if err := encoder.Encode(&s, values); err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func BenchmarkAppendQuery(b *testing.B) {
+	encoder := qs.NewEncoder()
+	s := newPrimitive()
+	dst := make([]byte, 0, 512)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		var err error
+		if dst, err = encoder.AppendQuery(dst[:0], &s); err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func BenchmarkAppendEncoded(b *testing.B) {
+	encoder := qs.NewEncoder()
+	s := newPrimitive()
+	dst := make([]byte, 0, 512)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		var err error
+		if dst, err = encoder.AppendEncoded(dst[:0], &s); err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func BenchmarkEncodeToString(b *testing.B) {
+	encoder := qs.NewEncoder()
+	s := newPrimitive()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := encoder.EncodeToString(&s); err != nil {
+			b.Error(err)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package qs
+
+import (
+	"encoding"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+var (
+	paramDecoderType    = reflect.TypeOf(new(QueryParamDecoder)).Elem()
+	textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+)
+
+// DecoderOption provides option for Decoder
+type DecoderOption func(decoder *Decoder)
+
+// Decoder is the main instance to decode url.Values into structs, it is safe for concurrent use
+// Apply options by using WithDecoderTagAlias, WithDecoderDelimiterPolicy, WithDecoderArrayFormat,
+// WithDecoderNestedFormat, WithDecoderTimeLayout
+type Decoder struct {
+	tagAlias string
+	// delimiterPolicy tells whether elements of delimited lists are unescaped
+	delimiterPolicy DelimiterPolicy
+	// arrayFormat and nestedFormat are the formats of fields without their own format options
+	arrayFormat  listFormat
+	nestedFormat nestedFormat
+	// timeOption is the time format option of fields without their own, empty for RFC3339
+	timeOption string
+	cache      *decodeCacheStore
+}
+
+// WithDecoderTagAlias create a option to set custom tag alias instead of `qs`
+func WithDecoderTagAlias(tagAlias string) DecoderOption {
+	return func(decoder *Decoder) {
+		decoder.tagAlias = tagAlias
+	}
+}
+
+// WithDecoderDelimiterPolicy create a option to unescape elements of delimited lists
+// encoded with WithDelimiterPolicy(DelimiterEscape), other policies leave the elements as they are
+func WithDecoderDelimiterPolicy(policy DelimiterPolicy) DecoderOption {
+	return func(decoder *Decoder) {
+		decoder.delimiterPolicy = policy
+	}
+}
+
+// WithDecoderArrayFormat create a option to set the default format of slices and arrays (default is ArrayFormatRepeat),
+// it matches WithArrayFormat of the encoder. The `comma`, `bracket` and `index` tag options win over the default
+func WithDecoderArrayFormat(format ArrayFormat) DecoderOption {
+	return func(decoder *Decoder) {
+		decoder.arrayFormat = listFormat(format)
+	}
+}
+
+// WithDecoderNestedFormat create a option to set the default format of nested structs and maps
+// (default is NestedFormatBracket), it matches WithNestedFormat of the encoder.
+// The `bracket`, `dot`, `colon` and `flat` tag options win over the default
+func WithDecoderNestedFormat(format NestedFormat) DecoderOption {
+	return func(decoder *Decoder) {
+		decoder.nestedFormat = nestedFormat(format)
+	}
+}
+
+// WithDecoderTimeLayout create a option to set the default format of time.Time fields instead of RFC3339,
+// it matches WithTimeLayout of the encoder. Time format options on fields take precedence
+func WithDecoderTimeLayout(layout string) DecoderOption {
+	return func(decoder *Decoder) {
+		if _, _, ok := timeFormatFromOption(layout); ok {
+			decoder.timeOption = layout
+			return
+		}
+		decoder.timeOption = "layout=" + layout
+	}
+}
+
+// NewDecoder init new *Decoder instance
+// Use DecoderOption to apply options
+func NewDecoder(options ...DecoderOption) *Decoder {
+	d := &Decoder{
+		tagAlias: "qs",
+	}
+
+	// Apply options
+	for _, opt := range options {
+		opt(d)
+	}
+
+	d.cache = newDecodeCacheStore()
+
+	return d
+}
+
+// Decode decodes url.Values into the struct pointed to by v
+// v must be a non-nil pointer to struct
+func (d *Decoder) Decode(values url.Values, v interface{}) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return InvalidDecodeInputErr{Type: reflect.TypeOf(v)}
+	}
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return InvalidDecodeInputErr{Type: reflect.TypeOf(v)}
+	}
+	return d.structDecoder(val.Type()).decodeFnc(values, "", val)
+}
+
+// structDecoder returns the cached decoder plan of a struct type, building it on first use
+func (d *Decoder) structDecoder(typ reflect.Type) *structDecoder {
+	if dec := d.cache.Retrieve(typ); dec != nil {
+		return dec
+	}
+	dec := d.newStructDecoder(typ, nestedFormatBracket)
+	d.cache.Store(typ, dec)
+	return d.cache.Retrieve(typ)
+}
+
+func (d *Decoder) newStructDecoder(structTyp reflect.Type, notation nestedFormat) *structDecoder {
+	dec := &structDecoder{
+		notation: notation,
+		fields:   make([]structDecoderField, 0, structTyp.NumField()),
+	}
+
+	for i := 0; i < structTyp.NumField(); i++ {
+		structField := structTyp.Field(i)
+
+		if structField.PkgPath != "" && !isEmbeddedStruct(structField) { // unexported field
+			continue
+		}
+
+		name, opts := d.getTagNameAndOpts(structField)
+		if name == "-" { // ignored field
+			continue
+		}
+		opts = d.withDefaultOptions(opts)
+
+		fieldTyp := derefType(structField.Type)
+
+		// OpenAPI style and explode options are mapped onto the list and nested formats
+		var objectDelimiter string
+		if hasStyleOption(opts) {
+			opts, objectDelimiter = styleOptions(fieldTyp, newValueDecoder(fieldTyp, opts) != nil, opts)
+		}
+		if objectDelimiter != "" {
+			if field := d.newFieldDecoder(fieldTyp, opts); field != nil {
+				dec.fields = append(dec.fields, structDecoderField{
+					index:   i,
+					name:    name,
+					decoder: &objectDecoder{delimiter: objectDelimiter, decoder: field},
+				})
+			}
+			continue
+		}
+
+		// Embedded structs without tag name and structs with the flat option are flattened
+		notation := nestedFormatFromOptions(toTagOptions(opts))
+		flatten := isEmbeddedStruct(structField) && !hasTagName(structField, d.tagAlias) ||
+			fieldTyp.Kind() == reflect.Struct && notation == nestedFormatFlat
+		if flatten && newValueDecoder(fieldTyp, opts) == nil {
+			dec.fields = append(dec.fields, structDecoderField{
+				index:    i,
+				name:     name,
+				embedded: d.newStructDecoder(fieldTyp, dec.notation),
+			})
+			continue
+		}
+
+		field := d.newFieldDecoder(structField.Type, opts)
+		if field == nil {
+			// data type is not supported
+			continue
+		}
+		if mapDec, ok := field.(*mapDecoder); ok && notation == nestedFormatFlat {
+			// Entries of flat maps are decoded from the parent scope
+			mapDec.notation = dec.notation
+			dec.fields = append(dec.fields, structDecoderField{
+				index:   i,
+				name:    name,
+				decoder: mapDec,
+				flat:    true,
+			})
+			continue
+		}
+		var defaultOpts []string
+		if _, ok := defaultOption(opts); ok {
+			defaultOpts = opts
+		}
+		dec.fields = append(dec.fields, structDecoderField{
+			index:       i,
+			name:        name,
+			decoder:     field,
+			defaultOpts: defaultOpts,
+		})
+	}
+	d.hideShadowedFields(dec, structTyp)
+	excludeFieldNames(dec)
+	return dec
+}
+
+// excludeFieldNames prevents flat maps from decoding the keys of the other fields of a struct
+func excludeFieldNames(dec *structDecoder) {
+	var names map[string]bool
+	var collect func(dec *structDecoder)
+	collect = func(dec *structDecoder) {
+		for _, field := range dec.fields {
+			switch {
+			case field.embedded != nil:
+				collect(field.embedded)
+			case !field.flat:
+				names[field.name] = true
+			}
+		}
+	}
+	for _, field := range dec.fields {
+		if !field.flat {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]bool, len(dec.fields))
+			collect(dec)
+		}
+		field.decoder.(*mapDecoder).exclude = names
+	}
+}
+
+// hideShadowedFields removes fields shadowed by Go's rules for embedded structs
+func (d *Decoder) hideShadowedFields(dec *structDecoder, structTyp reflect.Type) {
+	var promoted []promotedField
+	var slots []*structDecoderField
+	hasEmbedded := false
+
+	var collect func(dec *structDecoder, typ reflect.Type, depth int)
+	collect = func(dec *structDecoder, typ reflect.Type, depth int) {
+		for i := range dec.fields {
+			field := &dec.fields[i]
+			if field.embedded != nil {
+				hasEmbedded = true
+				collect(field.embedded, derefType(typ.Field(field.index).Type), depth+1)
+				continue
+			}
+			promoted = append(promoted, promotedField{
+				name:   field.name,
+				depth:  depth,
+				tagged: hasTagName(typ.Field(field.index), d.tagAlias),
+			})
+			slots = append(slots, field)
+		}
+	}
+	collect(dec, structTyp, 0)
+
+	if !hasEmbedded {
+		return
+	}
+	for i, hidden := range hiddenFields(promoted) {
+		if hidden {
+			slots[i].hidden = true
+		}
+	}
+}
+
+func (d *Decoder) newFieldDecoder(fieldTyp reflect.Type, opts []string) fieldDecoder {
+	fieldTyp = derefType(fieldTyp)
+
+	if dec := newValueDecoder(fieldTyp, opts); dec != nil {
+		return dec
+	}
+
+	switch fieldTyp.Kind() {
+	case reflect.Struct:
+		return d.newStructDecoder(fieldTyp, d.notationOf(opts))
+	case reflect.Slice, reflect.Array:
+		return d.newListDecoder(fieldTyp.Elem(), opts)
+	case reflect.Map:
+		return newMapDecoder(fieldTyp.Key(), fieldTyp.Elem(), d.notationOf(opts), d.withDefaultOptions(nil))
+	case reflect.Interface:
+		return &interfaceDecoder{}
+	default:
+		return nil
+	}
+}
+
+func (d *Decoder) newListDecoder(elemTyp reflect.Type, opts []string) fieldDecoder {
+	dec := &listDecoder{
+		arrayFormat: d.arrayFormat,
+		delimiter:   ",",
+		unescape:    d.delimiterPolicy == DelimiterEscape,
+	}
+	for _, opt := range opts {
+		if delimiter, ok := delimiterFromOption(opt); ok {
+			dec.arrayFormat = arrayFormatComma
+			dec.delimiter = delimiter
+			continue
+		}
+		switch opt {
+		case "repeat":
+			dec.arrayFormat = arrayFormatRepeat
+		case "bracket":
+			dec.arrayFormat = arrayFormatBracket
+		case "index":
+			dec.arrayFormat = arrayFormatIndex
+		}
+	}
+
+	elemTyp = derefType(elemTyp)
+
+	if valueDec := newValueDecoder(elemTyp, opts); valueDec != nil {
+		dec.elemDecoder = valueDec
+		return dec
+	}
+
+	// Struct elements can only be addressed with the index format, e.g. list[0][name]
+	if elemTyp.Kind() == reflect.Struct && dec.arrayFormat == arrayFormatIndex {
+		dec.elemDecoder = d.newStructDecoder(elemTyp, nestedFormatBracket)
+		return dec
+	}
+	return nil
+}
+
+// withDefaultOptions prepends the time format option of the decoder to opts, so the options of the field win
+func (d *Decoder) withDefaultOptions(opts []string) []string {
+	if d.timeOption == "" {
+		return opts
+	}
+	return append([]string{d.timeOption}, opts...)
+}
+
+// notationOf returns the nested format given by the options, or the default format of the decoder
+func (d *Decoder) notationOf(opts []string) nestedFormat {
+	if notation, ok := nestedFormatOption(toTagOptions(opts)); ok {
+		return notation
+	}
+	return d.nestedFormat
+}
+
+// getTagNameAndOpts returns the query name and options of a struct field
+func (d *Decoder) getTagNameAndOpts(f reflect.StructField) (string, []string) {
+	tag := f.Tag.Get(d.tagAlias)
+	if len(tag) == 0 {
+		// no tag, using struct field name
+		return f.Name, nil
+	}
+	splitTags := strings.Split(tag, ",")
+	if len(splitTags[0]) == 0 {
+		splitTags[0] = f.Name
+	}
+	return splitTags[0], splitTags[1:]
+}
+
+// toTagOptions converts options into the form used by the encoder helpers
+func toTagOptions(opts []string) [][]byte {
+	tagOptions := make([][]byte, 0, len(opts))
+	for _, opt := range opts {
+		tagOptions = append(tagOptions, []byte(opt))
+	}
+	return tagOptions
+}
+
+// scopedKey joins a child name to its parent scope using the given notation
+func scopedKey(scope string, name string, notation nestedFormat) string {
+	if scope == "" {
+		return name
+	}
+	switch notation {
+	case nestedFormatDot:
+		return scope + "." + name
+	case nestedFormatColon:
+		return scope + ":" + name
+	default:
+		return scope + "[" + name + "]"
+	}
+}
@@ -0,0 +1,70 @@
+package qs
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type decodeCacheStore struct {
+	m     map[reflect.Type]*structDecoder
+	mutex sync.RWMutex
+}
+
+func newDecodeCacheStore() *decodeCacheStore {
+	return &decodeCacheStore{
+		m: make(map[reflect.Type]*structDecoder),
+	}
+}
+
+// Retrieve structDecoder corresponding to reflect.Type
+func (cacheStore *decodeCacheStore) Retrieve(typ reflect.Type) *structDecoder {
+	cacheStore.mutex.RLock()
+	defer cacheStore.mutex.RUnlock()
+	return cacheStore.m[typ]
+}
+
+// Store func stores structDecoder that corresponds to reflect.Type
+func (cacheStore *decodeCacheStore) Store(typ reflect.Type, dec *structDecoder) {
+	cacheStore.mutex.Lock()
+	defer cacheStore.mutex.Unlock()
+	if _, ok := cacheStore.m[typ]; !ok {
+		cacheStore.m[typ] = dec
+	}
+}
+
+type (
+	// fieldDecoder decodes the values found under key into v
+	fieldDecoder interface {
+		decodeFnc(values url.Values, key string, v reflect.Value) error
+	}
+)
+
+// indirect allocates nil pointers and returns the value they point to
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// hasScope reports whether values contain any key nested under scope
+func hasScope(values url.Values, scope string, notation nestedFormat) bool {
+	prefix := scope + "["
+	switch notation {
+	case nestedFormatDot:
+		prefix = scope + "."
+	case nestedFormatColon:
+		prefix = scope + ":"
+	}
+	for key := range values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,725 @@
+package qs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// structDecoder decodes the fields of a struct, nested or top-level
+type structDecoder struct {
+	notation nestedFormat
+	fields   []structDecoderField
+}
+
+type structDecoderField struct {
+	index   int
+	name    string
+	decoder fieldDecoder
+	// embedded is set for embedded structs whose fields are promoted to the parent scope
+	embedded *structDecoder
+	// hidden is set for fields shadowed by Go's rules for embedded structs
+	hidden bool
+	// flat is set for maps whose entries are decoded from the parent scope
+	flat bool
+	// defaultOpts holds the `default=` option, parsed for every field missing from the values
+	// so decoded slices and pointers are not shared, malformed defaults are reported when they are needed
+	defaultOpts []string
+}
+
+func (structDecoder *structDecoder) decodeFnc(values url.Values, key string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		// Only allocate nested struct pointers if any of their children are present
+		if !hasScope(values, key, structDecoder.notation) {
+			return nil
+		}
+		v = indirect(v)
+	}
+	return structDecoder.decodeFields(values, key, v)
+}
+
+func (structDecoder *structDecoder) decodeFields(values url.Values, key string, v reflect.Value) error {
+	for _, field := range structDecoder.fields {
+		if field.hidden {
+			continue
+		}
+		fieldVal := v.Field(field.index)
+		if !fieldVal.CanSet() && fieldVal.Kind() != reflect.Struct {
+			// unexported embedded field which can not be allocated
+			continue
+		}
+		var err error
+		switch {
+		case field.embedded != nil:
+			err = field.embedded.decodeEmbedded(values, key, fieldVal)
+		case field.flat:
+			err = field.decoder.decodeFnc(values, key, fieldVal)
+		default:
+			err = field.decoder.decodeFnc(values, scopedKey(key, field.name, structDecoder.notation), fieldVal)
+		}
+		if err != nil {
+			return err
+		}
+		if field.defaultOpts != nil && fieldVal.CanSet() && !structDecoder.isPresent(values, key, field, fieldVal) {
+			defaultValue, err := parseDefault(fieldVal.Type(), field.defaultOpts)
+			if err != nil {
+				str, _ := defaultOption(field.defaultOpts)
+				return DecodeError{Key: scopedKey(key, field.name, structDecoder.notation), Value: str, Type: fieldVal.Type(), Err: err}
+			}
+			fieldVal.Set(defaultValue)
+		}
+	}
+	return nil
+}
+
+// decodeEmbedded decodes the promoted fields of an embedded struct under the parent key,
+// nil pointers are only allocated if any of the promoted fields are present
+func (structDecoder *structDecoder) decodeEmbedded(values url.Values, key string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() && !structDecoder.hasFields(values, key) {
+		return nil
+	}
+	return structDecoder.decodeFields(values, key, indirect(v))
+}
+
+// hasFields reports whether values contain any field of the struct scoped under key
+func (structDecoder *structDecoder) hasFields(values url.Values, key string) bool {
+	for _, field := range structDecoder.fields {
+		if field.hidden {
+			continue
+		}
+		if field.embedded != nil {
+			if field.embedded.hasFields(values, key) {
+				return true
+			}
+			continue
+		}
+		if hasKey(values, scopedKey(key, field.name, structDecoder.notation)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPresent reports whether values hold the field, so its default is not applied to a zero value sent by the client
+// flat maps are decoded from the parent scope and are present once they hold any entry
+func (structDecoder *structDecoder) isPresent(values url.Values, key string, field structDecoderField, v reflect.Value) bool {
+	if field.embedded != nil || field.flat {
+		return !isNilOrZero(v)
+	}
+	return hasKey(values, scopedKey(key, field.name, structDecoder.notation))
+}
+
+// hasKey reports whether values contain fieldKey itself or any key scoped under it, e.g. "tags[]" or "user.name"
+func hasKey(values url.Values, fieldKey string) bool {
+	_, ok := values[fieldKey]
+	return ok || hasScope(values, fieldKey, nestedFormatBracket) ||
+		hasScope(values, fieldKey, nestedFormatDot) || hasScope(values, fieldKey, nestedFormatColon)
+}
+
+// listDecoder decodes slice/array fields
+type listDecoder struct {
+	elemDecoder fieldDecoder
+	arrayFormat listFormat
+	// delimiter splits the value of the delimited format, unescape reverts DelimiterEscape
+	delimiter string
+	unescape  bool
+}
+
+func (listDecoder *listDecoder) decodeFnc(values url.Values, key string, v reflect.Value) error {
+	if listDecoder.arrayFormat == arrayFormatIndex {
+		indexes := indexesOf(values, key)
+		if len(indexes) == 0 {
+			return nil
+		}
+		list, n := makeList(indirect(v), len(indexes))
+		for i := 0; i < n; i++ {
+			elemKey := key + "[" + strconv.Itoa(indexes[i]) + "]"
+			if err := listDecoder.elemDecoder.decodeFnc(values, elemKey, list.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var strs []string
+	switch listDecoder.arrayFormat {
+	case arrayFormatComma:
+		if vals := values[key]; len(vals) > 0 && vals[0] != "" {
+			strs = strings.Split(vals[0], listDecoder.delimiter)
+		}
+		if listDecoder.unescape {
+			for i, str := range strs {
+				unescaped, err := url.PathUnescape(str)
+				if err != nil {
+					return DecodeError{Key: key, Value: str, Type: v.Type(), Err: err}
+				}
+				strs[i] = unescaped
+			}
+		}
+	case arrayFormatBracket:
+		key += "[]"
+		strs = values[key]
+	default:
+		strs = values[key]
+	}
+	if len(strs) == 0 {
+		return nil
+	}
+
+	elemDecoder := listDecoder.elemDecoder.(*valueDecoder)
+	list, n := makeList(indirect(v), len(strs))
+	for i := 0; i < n; i++ {
+		if err := elemDecoder.decodeValue(strs[i], list.Index(i)); err != nil {
+			return DecodeError{Key: key, Value: strs[i], Type: list.Index(i).Type(), Err: err}
+		}
+	}
+	return nil
+}
+
+// objectDecoder decodes structs and maps serialized as a single delimited value of properties,
+// e.g. "color=R,100,G,200" for the OpenAPI form style without explode
+type objectDecoder struct {
+	delimiter string
+	// decoder decodes the properties as top-level keys
+	decoder fieldDecoder
+}
+
+func (objectDecoder *objectDecoder) decodeFnc(values url.Values, key string, v reflect.Value) error {
+	vals := values[key]
+	if len(vals) == 0 || vals[0] == "" {
+		return nil
+	}
+	parts := strings.Split(vals[0], objectDecoder.delimiter)
+	if len(parts)%2 != 0 {
+		return DecodeError{Key: key, Value: vals[0], Type: v.Type(), Err: errors.New("properties are not key and value pairs")}
+	}
+	properties := make(url.Values, len(parts)/2)
+	for i := 0; i < len(parts); i += 2 {
+		properties[parts[i]] = append(properties[parts[i]], parts[i+1])
+	}
+	return objectDecoder.decoder.decodeFnc(properties, "", indirect(v))
+}
+
+// makeList prepares a slice/array to hold n elements and returns how many elements fit in
+func makeList(list reflect.Value, n int) (reflect.Value, int) {
+	if list.Kind() == reflect.Array {
+		if list.Len() < n {
+			n = list.Len()
+		}
+		return list, n
+	}
+	list.Set(reflect.MakeSlice(list.Type(), n, n))
+	return list, n
+}
+
+// indexesOf returns the sorted, distinct indexes of the keys formatted as key[index]...
+func indexesOf(values url.Values, key string) []int {
+	prefix := key + "["
+	seen := make(map[int]struct{})
+	indexes := make([]int, 0)
+	for k := range values {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		rest := k[len(prefix):]
+		end := strings.IndexByte(rest, ']')
+		if end <= 0 {
+			continue
+		}
+		index, err := strconv.Atoi(rest[:end])
+		if err != nil || index < 0 {
+			continue
+		}
+		if _, ok := seen[index]; !ok {
+			seen[index] = struct{}{}
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// mapDecoder decodes map fields formatted as name[key]=value
+type mapDecoder struct {
+	keyType      reflect.Type
+	valueType    reflect.Type
+	keyDecoder   *valueDecoder
+	valueDecoder *valueDecoder
+	notation     nestedFormat
+	// exclude holds the names of the other fields of a struct for flat maps
+	exclude map[string]bool
+}
+
+func (mapDecoder *mapDecoder) decodeFnc(values url.Values, key string, v reflect.Value) error {
+	var m reflect.Value
+	for k, vals := range values {
+		if len(vals) == 0 {
+			continue
+		}
+		rawKey, ok := mapDecoder.entryKey(key, k)
+		if !ok {
+			continue
+		}
+
+		if !m.IsValid() {
+			m = indirect(v)
+			if m.IsNil() {
+				m.Set(reflect.MakeMap(m.Type()))
+			}
+		}
+
+		mapKey := reflect.New(mapDecoder.keyType).Elem()
+		if err := mapDecoder.keyDecoder.decodeValue(rawKey, mapKey); err != nil {
+			return DecodeError{Key: k, Value: rawKey, Type: mapDecoder.keyType, Err: err}
+		}
+		mapValue := reflect.New(mapDecoder.valueType).Elem()
+		if err := mapDecoder.valueDecoder.decodeValue(vals[0], mapValue); err != nil {
+			return DecodeError{Key: k, Value: vals[0], Type: mapDecoder.valueType, Err: err}
+		}
+		m.SetMapIndex(mapKey, mapValue)
+	}
+	return nil
+}
+
+// entryKey returns the map key of the query key k scoped under key, nested keys are not supported
+func (mapDecoder *mapDecoder) entryKey(key string, k string) (string, bool) {
+	var rawKey string
+	switch {
+	case key == "":
+		// flat map at the top level, keys scoped under other fields are skipped
+		if strings.ContainsAny(k, "[]") {
+			return "", false
+		}
+		if i := strings.IndexAny(k, ".:"); i >= 0 && mapDecoder.exclude[k[:i]] {
+			return "", false
+		}
+		rawKey = k
+	case mapDecoder.notation == nestedFormatDot:
+		if !strings.HasPrefix(k, key+".") {
+			return "", false
+		}
+		rawKey = k[len(key)+1:]
+		if strings.ContainsAny(rawKey, ".[") {
+			return "", false
+		}
+	case mapDecoder.notation == nestedFormatColon:
+		if !strings.HasPrefix(k, key+":") {
+			return "", false
+		}
+		rawKey = k[len(key)+1:]
+		if strings.ContainsAny(rawKey, ":[") {
+			return "", false
+		}
+	default:
+		if !strings.HasPrefix(k, key+"[") || !strings.HasSuffix(k, "]") {
+			return "", false
+		}
+		rawKey = k[len(key)+1 : len(k)-1]
+		if strings.Contains(rawKey, "][") {
+			return "", false
+		}
+	}
+	return rawKey, !mapDecoder.exclude[rawKey]
+}
+
+func newMapDecoder(keyType reflect.Type, valueType reflect.Type, notation nestedFormat, opts []string) fieldDecoder {
+	keyDecoder := newValueDecoder(derefType(keyType), opts)
+	valueDecoder := newValueDecoder(derefType(valueType), opts)
+	if keyDecoder == nil || valueDecoder == nil {
+		// data type is not supported
+		return nil
+	}
+	return &mapDecoder{
+		keyType:      keyType,
+		valueType:    valueType,
+		keyDecoder:   keyDecoder,
+		valueDecoder: valueDecoder,
+		notation:     notation,
+	}
+}
+
+// interfaceDecoder decodes into interface fields
+// A nil empty interface receives the raw string value,
+// a non-nil pointer held by the interface is decoded in place
+type interfaceDecoder struct{}
+
+func (interfaceDecoder *interfaceDecoder) decodeFnc(values url.Values, key string, v reflect.Value) error {
+	vals, ok := values[key]
+	if !ok || len(vals) == 0 {
+		return nil
+	}
+	v = indirect(v)
+
+	if !v.IsNil() && v.Elem().Kind() == reflect.Ptr && !v.Elem().IsNil() {
+		elem := v.Elem().Elem()
+		if valueDecoder := newValueDecoder(elem.Type(), nil); valueDecoder != nil {
+			if err := valueDecoder.decodeValue(vals[0], elem); err != nil {
+				return DecodeError{Key: key, Value: vals[0], Type: elem.Type(), Err: err}
+			}
+		}
+		return nil
+	}
+
+	if v.NumMethod() != 0 {
+		// can not assign a string to a non-empty interface
+		return nil
+	}
+	v.Set(reflect.ValueOf(vals[0]))
+	return nil
+}
+
+// QueryParamDecoder is an interface implemented by any type to decode itself from query param
+type QueryParamDecoder interface {
+	DecodeParam(string) error
+}
+
+// valueDecoder decodes a single query value into a basic type, time.Time, time.Duration,
+// encoding.TextUnmarshaler or custom type
+type valueDecoder struct {
+	kind       reflect.Kind
+	isCustom   bool
+	isText     bool
+	isTime     bool
+	timeFormat timeFormat
+	timeLayout string
+
+	isDuration     bool
+	durationFormat durationFormat
+}
+
+func (valueDecoder *valueDecoder) decodeFnc(values url.Values, key string, v reflect.Value) error {
+	vals, ok := values[key]
+	if !ok || len(vals) == 0 {
+		return nil
+	}
+	if err := valueDecoder.decodeValue(vals[0], v); err != nil {
+		return DecodeError{Key: key, Value: vals[0], Type: v.Type(), Err: err}
+	}
+	return nil
+}
+
+// decodeValue parses str into v
+// An empty value leaves pointers nil and sets other types to their zero value,
+// custom types receive the empty value through DecodeParam
+func (valueDecoder *valueDecoder) decodeValue(str string, v reflect.Value) error {
+	if str == "" {
+		if v.Kind() == reflect.Ptr {
+			return nil
+		}
+		if !valueDecoder.isCustom {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+	}
+	v = indirect(v)
+
+	if valueDecoder.isCustom {
+		if v.CanAddr() && v.Addr().Type().Implements(paramDecoderType) {
+			return v.Addr().Interface().(QueryParamDecoder).DecodeParam(str)
+		}
+		return v.Interface().(QueryParamDecoder).DecodeParam(str)
+	}
+
+	if valueDecoder.isText {
+		if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+		}
+		return v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+	}
+
+	if valueDecoder.isTime {
+		t, err := parseTime(str, valueDecoder.timeFormat, valueDecoder.timeLayout)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if valueDecoder.isDuration {
+		d, err := parseDuration(str, valueDecoder.durationFormat)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch valueDecoder.kind {
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(str, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Complex64, reflect.Complex128:
+		c, err := strconv.ParseComplex(str, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetComplex(c)
+	}
+	return nil
+}
+
+func parseTime(str string, format timeFormat, layout string) (time.Time, error) {
+	switch format {
+	case timeFormatSecond, timeFormatMillis, timeFormatMicros, timeFormatNanos:
+		i, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch format {
+		case timeFormatSecond:
+			return time.Unix(i, 0).UTC(), nil
+		case timeFormatMillis:
+			return time.UnixMilli(i).UTC(), nil
+		case timeFormatMicros:
+			return time.UnixMicro(i).UTC(), nil
+		default:
+			return time.Unix(0, i).UTC(), nil
+		}
+	case timeFormatFracSecond:
+		return parseFracSecond(str)
+	case timeFormatLayout:
+		return time.Parse(layout, str)
+	default:
+		return time.Parse(time.RFC3339, str)
+	}
+}
+
+// parseFracSecond parses unix seconds with an optional fractional part, e.g. 1580601600.123
+func parseFracSecond(str string) (time.Time, error) {
+	secStr, fracStr, _ := strings.Cut(str, ".")
+	neg := strings.HasPrefix(secStr, "-")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nsec int64
+	if fracStr != "" {
+		if len(fracStr) > 9 {
+			fracStr = fracStr[:9]
+		}
+		nsec, err = strconv.ParseInt(fracStr+strings.Repeat("0", 9-len(fracStr)), 10, 64)
+		if err != nil || nsec < 0 {
+			return time.Time{}, &strconv.NumError{Func: "ParseFloat", Num: str, Err: strconv.ErrSyntax}
+		}
+	}
+	if neg {
+		nsec = -nsec
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
+
+func parseDuration(str string, format durationFormat) (time.Duration, error) {
+	switch format {
+	case durationFormatSecond, durationFormatMillis:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return 0, err
+		}
+		unit := time.Second
+		if format == durationFormatMillis {
+			unit = time.Millisecond
+		}
+		return time.Duration(math.Round(f * float64(unit))), nil
+	case durationFormatNanos:
+		i, err := strconv.ParseInt(str, 10, 64)
+		return time.Duration(i), err
+	case durationFormatISO8601:
+		return parseISO8601Duration(str)
+	default:
+		return time.ParseDuration(str)
+	}
+}
+
+// parseISO8601Duration parses durations in days, hours, minutes and seconds, e.g. P1DT1H30M
+func parseISO8601Duration(str string) (time.Duration, error) {
+	invalidErr := fmt.Errorf("invalid ISO 8601 duration %q", str)
+
+	s := str
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	if len(s) < 3 || s[0] != 'P' {
+		return 0, invalidErr
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime {
+				return 0, invalidErr
+			}
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		i := strings.IndexAny(s, "DHMS")
+		if i <= 0 || strings.ContainsAny(s[:i], "+-") {
+			return 0, invalidErr
+		}
+		f, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, invalidErr
+		}
+		var unit time.Duration
+		switch {
+		case s[i] == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case s[i] == 'H' && inTime:
+			unit = time.Hour
+		case s[i] == 'M' && inTime:
+			unit = time.Minute
+		case s[i] == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, invalidErr
+		}
+		d += time.Duration(math.Round(f * float64(unit)))
+		s = s[i+1:]
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// newValueDecoder returns nil if typ is not a basic type, time.Time, time.Duration,
+// encoding.TextUnmarshaler or custom type
+func newValueDecoder(typ reflect.Type, opts []string) *valueDecoder {
+	if typ.Kind() != reflect.Interface &&
+		(typ.Implements(paramDecoderType) || reflect.PtrTo(typ).Implements(paramDecoderType)) {
+		return &valueDecoder{
+			kind:     typ.Kind(),
+			isCustom: true,
+		}
+	}
+
+	if typ == timeType {
+		dec := &valueDecoder{
+			kind:   typ.Kind(),
+			isTime: true,
+		}
+		for _, opt := range opts {
+			if format, layout, ok := timeFormatFromOption(opt); ok {
+				dec.timeFormat = format
+				dec.timeLayout = layout
+			}
+		}
+		return dec
+	}
+
+	if typ == durationType {
+		dec := &valueDecoder{
+			kind:       typ.Kind(),
+			isDuration: true,
+		}
+		for _, opt := range opts {
+			if format, ok := durationFormatFromOption(opt); ok {
+				dec.durationFormat = format
+			}
+		}
+		return dec
+	}
+
+	if typ.Kind() != reflect.Interface &&
+		(typ.Implements(textUnmarshalerType) || reflect.PtrTo(typ).Implements(textUnmarshalerType)) {
+		return &valueDecoder{
+			kind:   typ.Kind(),
+			isText: true,
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		return &valueDecoder{kind: typ.Kind()}
+	default:
+		return nil
+	}
+}
+
+// defaultOption returns the value of the `default=` option, ok is false if there is none
+func defaultOption(opts []string) (str string, ok bool) {
+	for _, opt := range opts {
+		if strings.HasPrefix(opt, "default=") {
+			str, ok = opt[len("default="):], true
+		}
+	}
+	return str, ok
+}
+
+// parseDefault parses the `default=` option into a value of typ, written like the query value of the field.
+// Elements of lists are separated by '|', the value is invalid if there is no `default=` option
+func parseDefault(typ reflect.Type, opts []string) (reflect.Value, error) {
+	str, ok := defaultOption(opts)
+	if !ok {
+		return reflect.Value{}, nil
+	}
+
+	value := reflect.New(typ).Elem()
+	elemTyp := derefType(typ)
+	if dec := newValueDecoder(elemTyp, opts); dec != nil {
+		if err := dec.decodeValue(str, value); err != nil {
+			return reflect.Value{}, err
+		}
+		return value, nil
+	}
+	if elemTyp.Kind() != reflect.Slice && elemTyp.Kind() != reflect.Array {
+		return reflect.Value{}, errors.New("default values are not supported by the type")
+	}
+	elemDec := newValueDecoder(derefType(elemTyp.Elem()), opts)
+	if elemDec == nil {
+		return reflect.Value{}, errors.New("default values are not supported by the element type")
+	}
+	strs := strings.Split(str, "|")
+	list, n := makeList(indirect(value), len(strs))
+	for i := 0; i < n; i++ {
+		if err := elemDec.decodeValue(strs[i], list.Index(i)); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return value, nil
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,1144 @@
+package qs
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecodeInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	var nilPtr *basicVal
+	str := "abc"
+
+	testCases := []struct {
+		name  string
+		input interface{}
+	}{
+		{
+			name:  "nil",
+			input: nil,
+		},
+		{
+			name:  "non-pointer struct",
+			input: basicVal{},
+		},
+		{
+			name:  "nil pointer",
+			input: nilPtr,
+		},
+		{
+			name:  "pointer to string",
+			input: &str,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			decoder := NewDecoder()
+			err := decoder.Decode(url.Values{}, testCase.input)
+			if err == nil {
+				t.Error("expected error but actual is nil")
+				t.FailNow()
+			}
+			var invalidErr InvalidDecodeInputErr
+			if !errors.As(err, &invalidErr) {
+				t.Errorf("expected InvalidDecodeInputErr, got %v", err)
+				t.FailNow()
+			}
+			if invalidErr.Type != reflect.TypeOf(testCase.input) {
+				t.Errorf("expected type %v, got %v", reflect.TypeOf(testCase.input), invalidErr.Type)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestDecodeBasicVal(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	tm := time.Unix(600, 0).UTC()
+	values := url.Values{
+		"string":     []string{"abc"},
+		"bool":       []string{"true"},
+		"int":        []string{"-1"},
+		"int8":       []string{"8"},
+		"int16":      []string{"16"},
+		"int32":      []string{"32"},
+		"int64":      []string{"64"},
+		"uint":       []string{"1"},
+		"uint8":      []string{"8"},
+		"uint16":     []string{"16"},
+		"uint32":     []string{"32"},
+		"uint64":     []string{"64"},
+		"uintptr":    []string{"7"},
+		"float32":    []string{"0.5"},
+		"float64":    []string{"1.25"},
+		"complex64":  []string{"(1+2i)"},
+		"complex128": []string{"(3+4i)"},
+		"time":       []string{tm.Format(time.RFC3339)},
+	}
+
+	var s basicVal
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := basicVal{
+		String:     "abc",
+		Bool:       true,
+		Int:        -1,
+		Int8:       8,
+		Int16:      16,
+		Int32:      32,
+		Int64:      64,
+		Uint:       1,
+		Uint8:      8,
+		Uint16:     16,
+		Uint32:     32,
+		Uint64:     64,
+		Uintptr:    7,
+		Float32:    0.5,
+		Float64:    1.25,
+		Complex64:  complex(1, 2),
+		Complex128: complex(3, 4),
+		Time:       tm,
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeBasicPtr(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	values := url.Values{
+		"string": []string{"abc"},
+		"bool":   []string{"1"},
+		"int":    []string{"5"},
+		"uint":   []string{""},
+	}
+
+	var s basicPtr
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := basicPtr{
+		String: withStr("abc"),
+		Bool:   withBool(true),
+		Int:    withInt(5),
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeIgnore(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder(WithDecoderTagAlias("go"))
+
+	s := struct {
+		anonymous string
+		Ignore    string `go:"-"`
+		Name      string `go:"name,omitempty"`
+		NoTag     int
+	}{}
+
+	values := url.Values{
+		"anonymous": []string{"a"},
+		"Ignore":    []string{"b"},
+		"-":         []string{"c"},
+		"name":      []string{"d"},
+		"NoTag":     []string{"1"},
+	}
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if s.anonymous != "" || s.Ignore != "" || s.Name != "d" || s.NoTag != 1 {
+		t.Errorf("unexpected decoded struct %+v", s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeTimeFormat(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	tm := time.Unix(600, 0).UTC()
+
+	type times struct {
+		Rfc3339   time.Time  `qs:"default_fmt"`
+		Second    time.Time  `qs:"default_second,second"`
+		Millis    time.Time  `qs:"default_millis,millis"`
+		MillisPtr *time.Time `qs:"default_millis_ptr,millis"`
+	}
+
+	values := url.Values{
+		"default_fmt":        []string{"1970-01-01T00:10:00Z"},
+		"default_second":     []string{"600"},
+		"default_millis":     []string{"600000"},
+		"default_millis_ptr": []string{"600000"},
+	}
+
+	var s times
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := times{
+		Rfc3339:   tm,
+		Second:    tm,
+		Millis:    tm,
+		MillisPtr: &tm,
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeArrayFormat(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type lists struct {
+		Repeat  []string  `qs:"repeat"`
+		Comma   []int     `qs:"comma,comma"`
+		Bracket []*string `qs:"bracket,bracket"`
+		Index   []uint    `qs:"index,index"`
+		Array   [2]bool   `qs:"array"`
+		Ptr     *[]int    `qs:"ptr"`
+		Missing []int     `qs:"missing"`
+	}
+
+	values := url.Values{
+		"repeat":    []string{"a", "b"},
+		"comma":     []string{"1,2,3"},
+		"bracket[]": []string{"x", "y"},
+		"index[1]":  []string{"20"},
+		"index[0]":  []string{"10"},
+		"index[9]":  []string{"90"},
+		"array":     []string{"true", "false", "true"},
+		"ptr":       []string{"7"},
+	}
+
+	var s lists
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := lists{
+		Repeat:  []string{"a", "b"},
+		Comma:   []int{1, 2, 3},
+		Bracket: []*string{withStr("x"), withStr("y")},
+		Index:   []uint{10, 20, 90},
+		Array:   [2]bool{true, false},
+		Ptr:     &[]int{7},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeNestedStruct(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	tm := time.Unix(600, 0).UTC()
+
+	type Geo struct {
+		Lat string `qs:"lat"`
+	}
+
+	type User struct {
+		Verified bool      `qs:"verified"`
+		From     time.Time `qs:"from,second"`
+		Name     *string   `qs:"name,omitempty"`
+		Geo      Geo       `qs:"geo"`
+	}
+
+	type query struct {
+		User       User   `qs:"user,dot"`
+		UserPtr    *User  `qs:"user_ptr"`
+		NilUserPtr *User  `qs:"nil_user_ptr"`
+		UserList   []User `qs:"user_list,index"`
+	}
+
+	values := url.Values{
+		"user.verified":           []string{"true"},
+		"user.from":               []string{"600"},
+		"user.geo[lat]":           []string{"10.5"},
+		"user_ptr[name]":          []string{"son"},
+		"user_ptr[geo][lat]":      []string{"21.0"},
+		"user_list[0][from]":      []string{"600"},
+		"user_list[0][name]":      []string{"abc"},
+		"user_list[1][verified]":  []string{"true"},
+		"user_list[1][geo][lat]":  []string{"1.5"},
+		"user_list[x][verified]":  []string{"true"},
+		"nil_user_ptr_other[abc]": []string{"true"},
+	}
+
+	var s query
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := query{
+		User: User{
+			Verified: true,
+			From:     tm,
+			Geo:      Geo{Lat: "10.5"},
+		},
+		UserPtr: &User{
+			Name: withStr("son"),
+			Geo:  Geo{Lat: "21.0"},
+		},
+		UserList: []User{
+			{
+				From: tm,
+				Name: withStr("abc"),
+			},
+			{
+				Verified: true,
+				Geo:      Geo{Lat: "1.5"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %+v, got %+v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeMap(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type maps struct {
+		Map    map[string]bool  `qs:"map,int"`
+		IntMap map[int]*string  `qs:"int_map"`
+		PtrMap *map[string]int  `qs:"ptr_map"`
+		NilMap map[string]int   `qs:"nil_map"`
+		Nested map[string][]int `qs:"nested"`
+	}
+
+	values := url.Values{
+		"map[abc]":     []string{"1"},
+		"map[xyz]":     []string{"false"},
+		"int_map[1]":   []string{"one"},
+		"ptr_map[a]":   []string{"5"},
+		"nested[a]":    []string{"1"},
+		"map[a][b]":    []string{"true"},
+		"other[abc]":   []string{"true"},
+		"nil_map_test": []string{"1"},
+	}
+
+	var s maps
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := maps{
+		Map:    map[string]bool{"abc": true, "xyz": false},
+		IntMap: map[int]*string{1: withStr("one")},
+		PtrMap: &map[string]int{"a": 5},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeInterface(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	s := struct {
+		String interface{} `qs:"string"`
+		IntPtr interface{} `qs:"int_ptr"`
+		Nil    interface{} `qs:"nil"`
+	}{
+		IntPtr: withInt(0),
+	}
+
+	values := url.Values{
+		"string":  []string{"abc"},
+		"int_ptr": []string{"5"},
+	}
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if s.String != "abc" {
+		t.Errorf("expected %v, got %v", "abc", s.String)
+		t.FailNow()
+	}
+	if *(s.IntPtr.(*int)) != 5 {
+		t.Errorf("expected %v, got %v", 5, *(s.IntPtr.(*int)))
+		t.FailNow()
+	}
+	if s.Nil != nil {
+		t.Errorf("expected nil, got %v", s.Nil)
+		t.FailNow()
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	testCases := []struct {
+		name     string
+		input    interface{}
+		values   url.Values
+		expected DecodeError
+	}{
+		{
+			name: "int",
+			input: &struct {
+				Int int `qs:"int"`
+			}{},
+			values:   url.Values{"int": []string{"abc"}},
+			expected: DecodeError{Key: "int", Value: "abc", Type: reflect.TypeOf(0)},
+		},
+		{
+			name: "comma list",
+			input: &struct {
+				List []uint8 `qs:"list,comma"`
+			}{},
+			values:   url.Values{"list": []string{"1,300"}},
+			expected: DecodeError{Key: "list", Value: "300", Type: reflect.TypeOf(uint8(0))},
+		},
+		{
+			name: "nested time",
+			input: &struct {
+				Nested struct {
+					Time time.Time `qs:"time,millis"`
+				} `qs:"nested"`
+			}{},
+			values:   url.Values{"nested[time]": []string{"now"}},
+			expected: DecodeError{Key: "nested[time]", Value: "now", Type: timeType},
+		},
+		{
+			name: "map key",
+			input: &struct {
+				Map map[int]string `qs:"map"`
+			}{},
+			values:   url.Values{"map[abc]": []string{"x"}},
+			expected: DecodeError{Key: "map[abc]", Value: "abc", Type: reflect.TypeOf(0)},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			err := decoder.Decode(testCase.values, testCase.input)
+			var decodeErr DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Errorf("expected DecodeError, got %v", err)
+				t.FailNow()
+			}
+			if decodeErr.Key != testCase.expected.Key ||
+				decodeErr.Value != testCase.expected.Value ||
+				decodeErr.Type != testCase.expected.Type {
+				t.Errorf("expected %v, got %v", testCase.expected, decodeErr)
+				t.FailNow()
+			}
+			if decodeErr.Unwrap() == nil {
+				t.Error("expected wrapped error, got nil")
+				t.FailNow()
+			}
+		})
+	}
+
+	var numErr *strconv.NumError
+	err := decoder.Decode(url.Values{"int": []string{"abc"}}, &struct {
+		Int int `qs:"int"`
+	}{})
+	if !errors.As(err, &numErr) {
+		t.Errorf("expected *strconv.NumError, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+	decoder := NewDecoder()
+
+	type Nested struct {
+		Time time.Time `qs:"time,second"`
+		Name *string   `qs:"name,omitempty"`
+	}
+
+	type query struct {
+		Tags    []string          `qs:"tags,bracket"`
+		IDs     []int             `qs:"ids,comma"`
+		Limit   int               `qs:"limit"`
+		Active  bool              `qs:"active,int"`
+		Nested  Nested            `qs:"nested,dot"`
+		List    []Nested          `qs:"list,index"`
+		Filters map[string]string `qs:"filters"`
+	}
+
+	tm := time.Unix(600, 0).UTC()
+	input := query{
+		Tags:   []string{"a", "b"},
+		IDs:    []int{1, 2},
+		Limit:  10,
+		Active: true,
+		Nested: Nested{Time: tm, Name: withStr("son")},
+		List: []Nested{
+			{Time: tm, Name: withStr("abc")},
+			{Time: tm},
+		},
+		Filters: map[string]string{"status": "open"},
+	}
+
+	values, err := encoder.Values(input)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+
+	var output query
+	if err = decoder.Decode(values, &output); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(input, output) {
+		t.Errorf("expected %+v, got %+v", input, output)
+		t.FailNow()
+	}
+}
+
+type DecodableTimestamp struct {
+	time.Time
+}
+
+func (t *DecodableTimestamp) DecodeParam(str string) error {
+	if str == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	tm, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return err
+	}
+	t.Time = tm
+	return nil
+}
+
+type Upper string
+
+func (u *Upper) DecodeParam(str string) error {
+	*u = Upper(strings.ToUpper(str))
+	return nil
+}
+
+type ErrDecodable struct{}
+
+func (e *ErrDecodable) DecodeParam(string) error {
+	return fmt.Errorf("failed to decode param")
+}
+
+func TestDecodeCustomType(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type query struct {
+		Timestamp    DecodableTimestamp             `qs:"ts"`
+		TimestampPtr *DecodableTimestamp            `qs:"ts_ptr"`
+		NilPtr       *DecodableTimestamp            `qs:"nil_ptr"`
+		Empty        DecodableTimestamp             `qs:"empty"`
+		List         []Upper                        `qs:"list,comma"`
+		PtrList      []*Upper                       `qs:"ptr_list,index"`
+		KeyMap       map[Upper]int                  `qs:"key_map"`
+		ValueMap     map[string]*DecodableTimestamp `qs:"value_map"`
+	}
+
+	tm := time.Unix(600, 0).UTC()
+	values := url.Values{
+		"ts":             []string{tm.Format(time.RFC3339)},
+		"ts_ptr":         []string{tm.Format(time.RFC3339)},
+		"nil_ptr":        []string{""},
+		"empty":          []string{""},
+		"list":           []string{"a,b"},
+		"ptr_list[0]":    []string{"c"},
+		"key_map[d]":     []string{"1"},
+		"value_map[abc]": []string{tm.Format(time.RFC3339)},
+	}
+
+	s := query{
+		Empty: DecodableTimestamp{tm},
+	}
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	upper := Upper("C")
+	expected := query{
+		Timestamp:    DecodableTimestamp{tm},
+		TimestampPtr: &DecodableTimestamp{tm},
+		List:         []Upper{"A", "B"},
+		PtrList:      []*Upper{&upper},
+		KeyMap:       map[Upper]int{"D": 1},
+		ValueMap:     map[string]*DecodableTimestamp{"abc": {tm}},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %+v, got %+v", expected, s)
+		t.FailNow()
+	}
+
+	err := decoder.Decode(url.Values{"err": []string{"x"}}, &struct {
+		Err ErrDecodable `qs:"err"`
+	}{})
+	var decodeErr DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("expected DecodeError, got %v", err)
+		t.FailNow()
+	}
+	if decodeErr.Key != "err" {
+		t.Errorf("expected key %v, got %v", "err", decodeErr.Key)
+		t.FailNow()
+	}
+}
+
+func TestDecodeTimeLayout(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+	decoder := NewDecoder()
+
+	type times struct {
+		Layout      time.Time `qs:"layout,layout=2006-01-02 15:04"`
+		Date        time.Time `qs:"date,date"`
+		Rfc3339Nano time.Time `qs:"rfc3339nano,rfc3339nano"`
+		Micros      time.Time `qs:"micros,micros"`
+		Nanos       time.Time `qs:"nanos,nanos"`
+		FracSecond  time.Time `qs:"frac,fracsecond"`
+		Before      time.Time `qs:"before,fracsecond"`
+	}
+
+	tm := time.Unix(1580601600, 123456789).UTC()
+	input := times{
+		Layout:      tm.Truncate(time.Minute),
+		Date:        tm.Truncate(24 * time.Hour),
+		Rfc3339Nano: tm,
+		Micros:      tm.Truncate(time.Microsecond),
+		Nanos:       tm,
+		FracSecond:  tm,
+		Before:      time.Unix(-2, 500000000).UTC(),
+	}
+
+	values, err := encoder.Values(input)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	var output times
+	if err = decoder.Decode(values, &output); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(input, output) {
+		t.Errorf("expected %v, got %v", input, output)
+		t.FailNow()
+	}
+
+	err = decoder.Decode(url.Values{"frac": []string{"1.-5"}}, &output)
+	var decodeErr DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("expected DecodeError, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestDecodeDuration(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type durations struct {
+		Default time.Duration   `qs:"default"`
+		Second  time.Duration   `qs:"second,second"`
+		Millis  time.Duration   `qs:"millis,millis"`
+		Nanos   time.Duration   `qs:"nanos,nanos"`
+		ISO8601 time.Duration   `qs:"iso8601,iso8601"`
+		Days    time.Duration   `qs:"days,iso8601"`
+		Ptr     *time.Duration  `qs:"ptr"`
+		List    []time.Duration `qs:"list,second,comma"`
+	}
+
+	values := url.Values{
+		"default": []string{"1h30m1.5s"},
+		"second":  []string{"5401.5"},
+		"millis":  []string{"5401500"},
+		"nanos":   []string{"5401500000000"},
+		"iso8601": []string{"PT1H30M1.5S"},
+		"days":    []string{"-P1DT2H"},
+		"ptr":     []string{"2m"},
+		"list":    []string{"1,120"},
+	}
+
+	var s durations
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	d := time.Hour + 30*time.Minute + 1500*time.Millisecond
+	ptr := 2 * time.Minute
+	expected := durations{
+		Default: d,
+		Second:  d,
+		Millis:  d,
+		Nanos:   d,
+		ISO8601: d,
+		Days:    -26 * time.Hour,
+		Ptr:     &ptr,
+		List:    []time.Duration{time.Second, 2 * time.Minute},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+
+	for _, invalid := range []string{"P", "PT", "1H", "PT1D", "P1H", "PT-1H", "PTxS", "PT1HT1M"} {
+		err := decoder.Decode(url.Values{"iso8601": []string{invalid}}, &s)
+		var decodeErr DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("expected DecodeError for %q, got %v", invalid, err)
+			t.FailNow()
+		}
+	}
+}
+
+type textUnmarshalPoint struct {
+	X, Y int
+}
+
+func (p *textUnmarshalPoint) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d:%d", &p.X, &p.Y)
+	return err
+}
+
+func TestDecodeTextUnmarshaler(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type texts struct {
+		Addr    netip.Addr           `qs:"addr"`
+		AddrPtr *netip.Addr          `qs:"addr_ptr"`
+		Point   textUnmarshalPoint   `qs:"point"`
+		Points  []textUnmarshalPoint `qs:"points,comma"`
+		Empty   netip.Addr           `qs:"empty"`
+	}
+
+	values := url.Values{
+		"addr":     []string{"10.0.0.1"},
+		"addr_ptr": []string{"::1"},
+		"point":    []string{"1:2"},
+		"points":   []string{"3:4,5:6"},
+		"empty":    []string{""},
+	}
+
+	var s texts
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	addrPtr := netip.MustParseAddr("::1")
+	expected := texts{
+		Addr:    netip.MustParseAddr("10.0.0.1"),
+		AddrPtr: &addrPtr,
+		Point:   textUnmarshalPoint{X: 1, Y: 2},
+		Points:  []textUnmarshalPoint{{X: 3, Y: 4}, {X: 5, Y: 6}},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+
+	err := decoder.Decode(url.Values{"addr": []string{"not-an-ip"}}, &s)
+	var decodeErr DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Key != "addr" {
+		t.Errorf("expected DecodeError at addr, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestDecodeEmbeddedStruct(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type query struct {
+		Pagination
+		*Sorting
+		Named Pagination `qs:"named"`
+		Page  string     `qs:"page"`
+	}
+
+	values := url.Values{
+		"page":        []string{"first"},
+		"limit":       []string{"10"},
+		"sort":        []string{"name"},
+		"named[page]": []string{"2"},
+	}
+
+	var s query
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	// page is shadowed by the outer field, limit is ambiguous between Pagination and Sorting
+	expected := query{
+		Sorting: &Sorting{Sort: "name"},
+		Named:   Pagination{Page: 2},
+		Page:    "first",
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+
+	var empty query
+	if err := decoder.Decode(url.Values{"page": []string{"first"}}, &empty); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if empty.Sorting != nil {
+		t.Errorf("expected nil embedded pointer, got %v", empty.Sorting)
+		t.FailNow()
+	}
+}
+
+func TestDecoderConcurrentUse(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type query struct {
+		ID   int            `qs:"id"`
+		Tags map[string]int `qs:"tags"`
+		Pagination
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values := url.Values{
+				"id":      []string{strconv.Itoa(i)},
+				"tags[k]": []string{strconv.Itoa(i)},
+				"page":    []string{strconv.Itoa(i)},
+			}
+			var s query
+			if err := decoder.Decode(values, &s); err != nil {
+				errs <- err.Error()
+				return
+			}
+			expected := query{ID: i, Tags: map[string]int{"k": i}, Pagination: Pagination{Page: i}}
+			if !reflect.DeepEqual(expected, s) {
+				errs <- fmt.Sprintf("expected %v, got %v", expected, s)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestDecodeMapNotation(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	type user struct {
+		Name string `qs:"name"`
+	}
+	type filter struct {
+		Status string            `qs:"status"`
+		Extra  map[string]string `qs:"extra,flat"`
+	}
+	type query struct {
+		Limit   int               `qs:"limit"`
+		Bracket map[string]string `qs:"bracket"`
+		Dot     map[string]string `qs:"dot,dot"`
+		Colon   map[string]int    `qs:"colon,colon"`
+		Flat    map[string]string `qs:"flat,flat"`
+		Filter  filter            `qs:"filter,dot"`
+		Author  user              `qs:"author,colon"`
+		Inline  *user             `qs:"inline,flat"`
+	}
+
+	values := url.Values{
+		"limit":         []string{"10"},
+		"bracket[a]":    []string{"1"},
+		"dot.b":         []string{"2"},
+		"colon:c":       []string{"3"},
+		"d":             []string{"4"},
+		"filter.status": []string{"open"},
+		"filter.e":      []string{"5"},
+		"author:name":   []string{"huynh"},
+		"name":          []string{"inline"},
+	}
+
+	var s query
+	if err := decoder.Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	// The flat map receives the top-level keys which do not belong to other fields
+	expected := query{
+		Limit:   10,
+		Bracket: map[string]string{"a": "1"},
+		Dot:     map[string]string{"b": "2"},
+		Colon:   map[string]int{"c": 3},
+		Flat:    map[string]string{"d": "4"},
+		Filter:  filter{Status: "open", Extra: map[string]string{"e": "5"}},
+		Author:  user{Name: "huynh"},
+		Inline:  &user{Name: "inline"},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+}
+
+func TestDecodeListDelimiters(t *testing.T) {
+	t.Parallel()
+
+	type query struct {
+		Space     []string `qs:"space,space"`
+		Pipe      []int    `qs:"pipe,pipe"`
+		Semicolon []string `qs:"semicolon,delim=;"`
+		Tab       []string `qs:"tab,delim=\\t"`
+	}
+	values := url.Values{
+		"space":     []string{"a b"},
+		"pipe":      []string{"1|2|3"},
+		"semicolon": []string{"a;b"},
+		"tab":       []string{"a\tb"},
+	}
+	var s query
+	if err := NewDecoder().Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := query{
+		Space:     []string{"a", "b"},
+		Pipe:      []int{1, 2, 3},
+		Semicolon: []string{"a", "b"},
+		Tab:       []string{"a", "b"},
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+
+	// Escaped elements round trip with the same policy on both sides
+	type tags struct {
+		Tags []string `qs:"tags,pipe"`
+	}
+	values, err := NewEncoder(WithDelimiterPolicy(DelimiterEscape)).Values(tags{Tags: []string{"a|b", "c%d"}})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	var decoded tags
+	if err := NewDecoder(WithDecoderDelimiterPolicy(DelimiterEscape)).Decode(values, &decoded); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual([]string{"a|b", "c%d"}, decoded.Tags) {
+		t.Errorf("expected %v, got %v", []string{"a|b", "c%d"}, decoded.Tags)
+		t.FailNow()
+	}
+}
+
+func TestDecodeOpenAPIStyles(t *testing.T) {
+	t.Parallel()
+	color := openAPIColor{R: 100, G: 200, B: 150}
+	expected := openAPIQuery{
+		IDs:    []int{3, 4, 5},
+		CSV:    []int{3, 4, 5},
+		Space:  []int{3, 4, 5},
+		Pipe:   []int{3, 4, 5},
+		Deep:   color,
+		Joined: color,
+		Piped:  &color,
+		Extra:  map[string]string{"x": "1"},
+	}
+	values, err := NewEncoder().Values(expected)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+
+	var s openAPIQuery
+	if err := NewDecoder().Decode(values, &s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(expected, s) {
+		t.Errorf("expected %v, got %v", expected, s)
+		t.FailNow()
+	}
+
+	err = NewDecoder().Decode(url.Values{"joined": []string{"R,100,G"}}, &s)
+	var decodeErr DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Key != "joined" {
+		t.Errorf("expected decode error of key joined but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestDecodeDefault(t *testing.T) {
+	t.Parallel()
+	decoder := NewDecoder()
+
+	var first, second defaultQuery
+	if err := decoder.Decode(url.Values{"size": []string{"2"}}, &first); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	page := 1
+	expected := defaultQuery{
+		Limit: 20,
+		Sort:  "name",
+		From:  time.Unix(1700000000, 0).UTC(),
+		Tags:  []string{"a", "b"},
+		Page:  &page,
+		Size:  2,
+	}
+	if !reflect.DeepEqual(expected, first) {
+		t.Errorf("expected %v, got %v", expected, first)
+		t.FailNow()
+	}
+
+	// Decoded defaults are not shared
+	first.Tags[0] = "changed"
+	*first.Page = 2
+	if err := decoder.Decode(url.Values{"limit": []string{"5"}}, &second); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if second.Limit != 5 || second.Tags[0] != "a" || *second.Page != 1 {
+		t.Errorf("expected limit 5 with default tags and page, got %v %v %v", second.Limit, second.Tags, *second.Page)
+		t.FailNow()
+	}
+
+	// Malformed defaults are reported when the key is missing
+	var malformed struct {
+		Bad int `qs:"bad,default=x"`
+	}
+	if err := decoder.Decode(url.Values{"bad": {"1"}}, &malformed); err != nil || malformed.Bad != 1 {
+		t.Errorf("expected bad 1 without error but got %v %v", malformed.Bad, err)
+		t.FailNow()
+	}
+	err := decoder.Decode(url.Values{}, &malformed)
+	var decodeErr DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Key != "bad" || decodeErr.Value != "x" {
+		t.Errorf("expected decode error of key bad but got %v", err)
+		t.FailNow()
+	}
+
+	// Zero values sent by the client are kept
+	var explicit struct {
+		Active bool     `qs:"active,default=true"`
+		Lim    int      `qs:"lim,default=20"`
+		Tags   []string `qs:"tags,bracket,default=a|b"`
+	}
+	if err := decoder.Decode(url.Values{"active": {"false"}, "lim": {"0"}, "tags[]": {""}}, &explicit); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if explicit.Active || explicit.Lim != 0 || reflect.DeepEqual([]string{"a", "b"}, explicit.Tags) {
+		t.Errorf("expected explicit zero values, got %+v", explicit)
+		t.FailNow()
+	}
+}
+
+type roundTripBase struct {
+	ID int `qs:"id"`
+}
+
+type roundTripUser struct {
+	roundTripBase
+	Name  string    `qs:"name"`
+	Since time.Time `qs:"since,second"`
+}
+
+type roundTripItem struct {
+	Name string `qs:"name"`
+}
+
+type roundTripQuery struct {
+	IDs    []int                `qs:"ids"`
+	Tags   []string             `qs:"tags,bracket"`
+	User   roundTripUser        `qs:"user"`
+	Owner  roundTripUser        `qs:"owner,bracket"`
+	From   time.Time            `qs:"from"`
+	Until  time.Time            `qs:"until,default=2021-01-01"`
+	Items  []roundTripItem      `qs:"items,index"`
+	Filter map[string]int       `qs:"filter"`
+	Dates  map[string]time.Time `qs:"dates"`
+}
+
+func TestDecodeEncoderDefaults(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder(WithArrayFormat(ArrayFormatComma), WithNestedFormat(NestedFormatDot), WithTimeLayout("date"))
+	decoder := NewDecoder(WithDecoderArrayFormat(ArrayFormatComma), WithDecoderNestedFormat(NestedFormatDot),
+		WithDecoderTimeLayout("date"))
+
+	query := roundTripQuery{
+		IDs:    []int{1, 2},
+		Tags:   []string{"a", "b"},
+		User:   roundTripUser{roundTripBase: roundTripBase{ID: 3}, Name: "x", Since: time.Unix(1700000000, 0).UTC()},
+		Owner:  roundTripUser{Name: "y"},
+		From:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Items:  []roundTripItem{{Name: "i"}},
+		Filter: map[string]int{"status": 1},
+		Dates:  map[string]time.Time{"due": time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	values, err := encoder.Values(query)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if values.Get("ids") != "1,2" || values.Get("user.name") != "x" || values.Get("owner[name]") != "y" ||
+		values.Get("from") != "2020-01-02" || values.Get("items[0][name]") != "i" || values.Get("dates.due") != "2020-03-04" {
+		t.Errorf("expected the encoder defaults to apply, got %v", values)
+		t.FailNow()
+	}
+
+	var decoded roundTripQuery
+	if err := decoder.Decode(values, &decoded); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	query.Until = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !reflect.DeepEqual(query, decoded) {
+		t.Errorf("expected %+v, got %+v", query, decoded)
+		t.FailNow()
+	}
+}
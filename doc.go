@@ -1,23 +1,38 @@
 // Copyright 2020 Son Huynh. All rights reserved.
 
 /*
-Package qs encodes structs into url.Values.
+Package qs encodes structs into url.Values and decodes url.Values back into structs.
 
 Package exports `NewEncoder()` function to create an encoder.
+Encoder caches struct info and is safe for concurrent use, use a single instance is recommended.
 Use `WithTagAlias()` func to register custom tag alias (default is `qs`)
 
 	encoder = qs.NewEncoder(
 		qs.WithTagAlias("myTag"),
 	)
 
-Encoder has `.Values()` and `Encode()` functions to encode structs into url.Values.
+Encoder has `.Values()` and `Encode()` functions to encode structs or maps into url.Values.
+`AppendQuery()` appends the encoded query to a byte slice, reusing it avoids allocations for basic types.
+`EncodeToString()` and `AppendEncoded()` write the escaped query directly in struct field order,
+use `WithSortedOutput()` to sort it by key like url.Values.Encode.
+`Pairs()` returns the params as an ordered list keeping struct field order and slice order,
+use `WithSortedMapKeys()` to sort map entries by key.
+`SetQuery()`, `AppendToURL()` and `NewRequest()` encode the params into a request or URL,
+merging them with the params already there following `WithConflictPolicy()` (replace, append or error).
+`FormBody()`, `NewFormRequest()` and `PostForm()` send the params as an application/x-www-form-urlencoded body.
+`WriteMultipart()`, `MultipartBody()` and `NewMultipartRequest()` write multipart/form-data bodies with the same keys,
+fields declared as File, *os.File or io.Reader become file parts.
 
 Supported data types:
   - all basic types (`bool`, `uint`, `string`, `float64`,...)
   - struct
   - slice/array
+  - map
   - pointer
   - time.Time
+  - time.Duration
+  - encoding.TextMarshaler, fmt.Stringer (opt-in)
+  - File, *os.File, io.Reader (file parts of multipart bodies)
   - custom type
 
 Example
@@ -58,6 +73,15 @@ Omitempty
 		Field2 *int		`form:"field2,omitempty"`
 	}
 
+Use the `default=...` option to send a value when the field is nil or zero, it is written like the query value
+of the field and elements of slices are separated by '|'. The decoder sets it when the key is missing from the query.
+Malformed defaults are reported when they are needed, in ValidationErrors by the encoder and in DecodeError by the decoder.
+
+	type Query struct {
+		Limit int      `qs:"limit,default=20"`
+		Tags  []string `qs:"tags,default=new|hot"`
+	}
+
 By default, package encodes time.Time values as RFC3339 format.
 
 Including the `"second"` or `"millis"` option to signal that the field should be encoded as second or millisecond.
@@ -80,6 +104,31 @@ Including the `"second"` or `"millis"` option to signal that the field should be
 	values, _ := encoder.Values(query)
 	fmt.Println(values.Encode()) // (unescaped) output: "default_fmt=2020-02-02T00:00:00Z&millis_fmt=1580601600000&second_fmt=1580601600"
 
+Other time format options are `micros`, `nanos`, `fracsecond` (seconds with fractional part),
+the named layouts `date`, `rfc3339nano`, `rfc1123`, `rfc1123z`
+and `layout=...` for any time layout without comma.
+
+	type Query struct {
+		Day  time.Time `qs:"day,date"`
+		From time.Time `qs:"from,layout=2006-01-02 15:04"`
+	}
+
+Use `WithTimeLayout()` to set the default format of time fields and
+`WithTimeLocation()` to convert times into a location before encoding.
+
+	encoder = qs.NewEncoder(
+		qs.WithTimeLayout("date"),
+		qs.WithTimeLocation(time.UTC),
+	)
+
+By default, package encodes time.Duration values with `String()`, e.g. "1h30m0s".
+Use the `second`, `millis`, `nanos` or `iso8601` option to change the format.
+
+	type Query struct {
+		Timeout time.Duration `qs:"timeout,second"` // 90 * time.Minute => "5400"
+		Window  time.Duration `qs:"window,iso8601"` // 90 * time.Minute => "PT1H30M"
+	}
+
 Slice and Array default to encoding into multiple URL values of the same value name.
 
 	type Query struct {
@@ -98,6 +147,21 @@ Including the `comma` option to signal that the field should be encoded as a sin
 	values, _ := encoder.Values(&Query{Tags: []string{"foo","bar"}})
 	fmt.Println(values.Encode()) //(unescaped) output: "tags=foo,bar"
 
+Other delimiters are available with the `space`, `pipe` and `delim=...` options (escape sequences like `delim=\t` are allowed).
+
+	type Query struct {
+		Names []string `qs:"names,space"`
+		IDs   []int    `qs:"ids,pipe"`
+		Tags  []string `qs:"tags,delim=;"`
+	}
+
+	values, _ := encoder.Values(&Query{Names: []string{"a","b"}, IDs: []int{1,2}, Tags: []string{"foo","bar"}})
+	fmt.Println(values.Encode()) //(unescaped) output: "ids=1|2&names=a b&tags=foo;bar"
+
+Elements containing the delimiter are written as they are by default,
+use WithDelimiterPolicy to fail with ErrDelimiterInElement or to percent-encode the delimiter inside elements.
+The decoder reverts the escaping with WithDecoderDelimiterPolicy(DelimiterEscape).
+
 Including the `bracket` option to signal that the multiple URL values should have "[]" appended to the value name.
 
 	type Query struct {
@@ -147,6 +211,81 @@ declared on; nest it again on a deeper struct field to keep using dots.
 	values, _ := encoder.Values(querys)
 	fmt.Println(values.Encode()) //(unescaped) output: "user.from=1601623397728&user.verified=true"
 
+Use `WithArrayFormat()` and `WithNestedFormat()` to set the default formats of an encoder,
+tag options still win over the defaults.
+
+	encoder := qs.NewEncoder(qs.WithArrayFormat(qs.ArrayFormatComma), qs.WithNestedFormat(qs.NestedFormatDot))
+
+OpenAPI 3 parameters can be tagged with their `style=` (form, spaceDelimited, pipeDelimited, deepObject)
+and `explode=` values, which are mapped onto the formats above as the spec requires,
+e.g. "id=3,4,5" for form without explode or "color[R]=100" for deepObject.
+Structs and maps which are not exploded are joined into a single value like "color=R,100,G,200".
+
+	type Query struct {
+		IDs    []int `qs:"id,style=form,explode=false"`
+		Filter Color `qs:"filter,style=deepObject"`
+	}
+
+Fields of embedded structs are promoted to the parent level like encoding/json, following Go's shadowing rules.
+Give the embedded struct a tag name to scope it like a nested struct instead.
+
+	type Query struct {
+		Pagination // Page int `qs:"page"`, Limit int `qs:"limit"`
+		Status string `qs:"status"`
+	}
+
+	values, _ := encoder.Values(Query{Pagination: Pagination{Page: 1, Limit: 20}, Status: "open"})
+	fmt.Println(values.Encode()) //(unescaped) output: "limit=20&page=1&status=open"
+
+Slices, arrays, maps and structs can be nested at any depth, every level is scoped under its parent key.
+Layout options (`comma`, `bracket`, `index`, `dot`) of a slice or map field also apply to the slices and maps nested in it.
+
+	type Item struct {
+		Name string   `qs:"name"`
+		Tags []string `qs:"tags,index"`
+	}
+
+	type Query struct {
+		Items []Item           `qs:"items,index"`
+		Grid  [][]int          `qs:"grid,index"`
+		Sizes map[string][]int `qs:"sizes"`
+	}
+
+	values, _ := encoder.Values(Query{
+		Items: []Item{{Name: "a", Tags: []string{"x", "y"}}},
+		Grid:  [][]int{{1, 2}},
+		Sizes: map[string][]int{"s": {36, 37}},
+	})
+	fmt.Println(values.Encode())
+	//(unescaped) output: "grid[0][0]=1&grid[0][1]=2&items[0][name]=a&items[0][tags][0]=x&items[0][tags][1]=y&sizes[s]=36&sizes[s]=37"
+
+Map keys follow the `dot` and `colon` options like nested structs (filter.status, facet:color),
+the `flat` option promotes map entries and struct fields to the parent level.
+
+	type Query struct {
+		Filter map[string]string `qs:"filter,dot"`  // filter.status=open
+		Facets map[string]string `qs:"facet,colon"` // facet:color=red
+		Extra  map[string]string `qs:"extra,flat"`  // debug=1
+	}
+
+Add the `sorted` option to a map field to emit its entries sorted by their encoded key
+instead of map iteration order, `WithSortedMapKeys()` sorts every map.
+
+	type Query struct {
+		Scores map[string]int `qs:"scores,sorted"`
+	}
+
+Maps can also be encoded at the top level, each entry becomes a key=value pair
+and nested maps/structs are scoped under their key with brackets.
+
+	values, _ := encoder.Values(map[string]interface{}{
+		"limit": 20,
+		"filter": map[string]interface{}{
+			"status": "open",
+		},
+	})
+	fmt.Println(values.Encode()) //(unescaped) output: "filter[status]=open&limit=20"
+
 Custom type
 Implement `EncodeParam` to encode itself into query param.
 Implement `IsZero` to check whether an object is zero to determine whether it should be omitted when encoding.
@@ -185,9 +324,95 @@ Implement `IsZero` to check whether an object is zero to determine whether it sh
 	}
 	fmt.Println(values.Encode()) //(unescaped) output: "user=sonhuynh"
 
-Limitation
-  - `interface`, `[]interface`, `map` are not supported yet
-  - `struct`, `slice`/`array` multi-level nesting are limited
-  - no decoder yet
+Implement `EncodeValues` to encode itself into several query params,
+it receives the scoped name of the field and keys are emitted in sorted order.
+
+	func (b BoundingBox) EncodeValues(key string, v url.Values) error {
+		v.Set(key+"[min_lat]", strconv.FormatFloat(b.MinLat, 'f', -1, 64))
+		v.Set(key+"[max_lat]", strconv.FormatFloat(b.MaxLat, 'f', -1, 64))
+		return nil
+	}
+
+Types which cannot implement `EncodeParam` can be registered with `WithCustomType()`,
+registered types take precedence over every other encoding rule.
+
+	encoder := qs.NewEncoder(qs.WithCustomType(uuid.UUID{}, func(v reflect.Value) (string, error) {
+		return v.Interface().(uuid.UUID).String(), nil
+	}))
+
+TextMarshaler and Stringer
+Types implementing encoding.TextMarshaler are encoded with `MarshalText`, types implementing fmt.Stringer
+are encoded with `String` when the encoder is created with `WithStringer()`.
+`EncodeParam` and `EncodeValues` win over time.Time and time.Duration formats, which win over `MarshalText`, then `String`.
+
+	encoder := qs.NewEncoder(qs.WithStringer())
+	values, _ := encoder.Values(struct {
+		Addr netip.Addr `qs:"addr"`
+	}{Addr: netip.MustParseAddr("10.0.0.1")})
+	fmt.Println(values.Encode()) //(unescaped) output: "addr=10.0.0.1"
+
+Errors returned by `EncodeParam`, `EncodeValues` or `MarshalText` are wrapped in `EncodeError`, which carries the Go field path
+(e.g. `Filter.Users[3].Since`) and the query key being produced.
+
+	_, err := encoder.Values(query)
+	var encodeErr qs.EncodeError
+	if errors.As(err, &encodeErr) {
+		fmt.Println(encodeErr.Path, encodeErr.Key)
+	}
+
+The validation options `required`, `min=`, `max=`, `maxlen=` and `oneof=a|b|c` are checked while encoding,
+every violation is reported at once in ValidationErrors with its field path, key and violated option.
+Nothing is written into the values of Encode or the writer of WriteMultipart when an error is returned.
+
+	type Query struct {
+		Limit int    `qs:"limit,min=1,max=100"`
+		Sort  string `qs:"sort,omitempty,oneof=name|date"`
+	}
+
+Decoder
+Package exports `NewDecoder()` function to create a decoder which reads url.Values
+into a struct using the same tags and options as the encoder.
+Use `WithDecoderTagAlias()` func to register custom tag alias (default is `qs`)
+
+	type Query struct {
+		Tags  []string  `qs:"tags,comma"`
+		Limit int       `qs:"limit"`
+		From  time.Time `qs:"from,second"`
+		User  User      `qs:"user,dot"`
+	}
+
+	values, _ := url.ParseQuery("tags=foo,bar&limit=24&from=1580601600&user.verified=true")
+
+	decoder := qs.NewDecoder()
+
+	var query Query
+	if err := decoder.Decode(values, &query); err != nil {
+		// Handle error
+	}
+
+Keys missing from url.Values leave their fields untouched.
+An empty value leaves pointer fields nil and sets other fields to their zero value.
+Slices of structs can only be decoded with the `index` option.
+
+The defaults of the encoder set by WithArrayFormat, WithNestedFormat, WithTimeLayout and WithDelimiterPolicy
+are read back with WithDecoderArrayFormat, WithDecoderNestedFormat, WithDecoderTimeLayout and WithDecoderDelimiterPolicy.
+
+Implement `DecodeParam` to decode a custom type from query param,
+it is used for fields, slice/array elements, map keys and map values.
+Types implementing encoding.TextUnmarshaler are decoded with `UnmarshalText`.
+
+	type Status int
+
+	func (s *Status) DecodeParam(str string) error {
+		switch str {
+		case "active":
+			*s = 1
+		case "inactive":
+			*s = 0
+		default:
+			return fmt.Errorf("unknown status %q", str)
+		}
+		return nil
+	}
 */
 package qs
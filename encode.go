@@ -1,8 +1,12 @@
 package qs
 
 import (
+	"bytes"
+	"encoding"
+	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -10,32 +14,71 @@ import (
 
 const (
 	tagOmitEmpty = "omitempty"
+	tagSorted    = "sorted"
 )
 
 var (
-	timeType    = reflect.TypeOf(time.Time{})
-	encoderType = reflect.TypeOf(new(QueryParamEncoder)).Elem()
-	zeroerType  = reflect.TypeOf(new(Zeroer)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	encoderType  = reflect.TypeOf(new(QueryParamEncoder)).Elem()
+	valuesType   = reflect.TypeOf(new(QueryValuesEncoder)).Elem()
+	zeroerType   = reflect.TypeOf(new(Zeroer)).Elem()
+
+	textMarshalerType = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	stringerType      = reflect.TypeOf(new(fmt.Stringer)).Elem()
 )
 
 // EncoderOption provides option for Encoder
 type EncoderOption func(encoder *Encoder)
 
-// Encoder is the main instance
-// Apply options by using WithTagAlias, WithCustomType
+// Encoder is the main instance, it is safe for concurrent use by multiple goroutines
+// Apply options by using WithTagAlias, WithTimeLayout, WithTimeLocation, WithStringer, WithCustomType,
+// WithSortedOutput, WithSortedMapKeys, WithArrayFormat, WithNestedFormat, WithDelimiterPolicy, WithConflictPolicy
 type Encoder struct {
-	tagAlias string
-	cache    *cacheStore
-	dataPool *sync.Pool
+	tagAlias     string
+	timeFormat   timeFormat
+	timeLayout   string
+	timeLocation *time.Location
+	useStringer  bool
+	arrayFormat  listFormat
+	nestedFormat nestedFormat
+	// delimiterPolicy handles elements of delimited lists containing the delimiter
+	delimiterPolicy DelimiterPolicy
+	sortedOutput    bool
+	// conflictPolicy merges the encoded params with the params already in a URL
+	conflictPolicy ConflictPolicy
+	// sortedMapKeys emits map entries sorted by their encoded key
+	sortedMapKeys bool
+	customTypes   map[reflect.Type]func(reflect.Value) (string, error)
+	cache         *cacheStore
+	dataPool      *sync.Pool
 }
 
 type encoder struct {
-	e      *Encoder
+	e *Encoder
+	// target receives the encoded values through result, otherwise pairs or out receive them
+	// result is created once per pooled encoder to avoid allocating a closure per field
+	target       url.Values
+	collectPairs bool
+	pairs        Pairs
+	out          []byte
+	result       resultFunc
+	// collectParts stages the params of WriteMultipart in parts, they are written once v is encoded without error
+	collectParts bool
+	parts        []formPart
+	// values and keys are pooled buffers of AppendQuery and Encode
 	values url.Values
+	keys   []string
 	tags   [][]byte
-	scope  []byte
 }
 
+const (
+	// maxPooledKeys limits the keys kept by a pooled encoder between uses
+	maxPooledKeys = 256
+	// maxPooledBytes limits the output buffer kept by a pooled encoder between uses
+	maxPooledBytes = 64 << 10
+)
+
 // WithTagAlias create a option to set custom tag alias instead of `qs`
 func WithTagAlias(tagAlias string) EncoderOption {
 	return func(encoder *Encoder) {
@@ -43,6 +86,105 @@ func WithTagAlias(tagAlias string) EncoderOption {
 	}
 }
 
+// WithTimeLayout create a option to set the default format of time.Time fields instead of RFC3339
+// layout is either a time layout or one of the named formats used as tag option,
+// e.g. "2006-01-02", "date", "rfc3339nano", "millis"
+// Time format options on fields take precedence
+func WithTimeLayout(layout string) EncoderOption {
+	return func(encoder *Encoder) {
+		if format, namedLayout, ok := timeFormatFromOption(layout); ok {
+			encoder.timeFormat = format
+			encoder.timeLayout = namedLayout
+			return
+		}
+		encoder.timeFormat = timeFormatLayout
+		encoder.timeLayout = layout
+	}
+}
+
+// WithTimeLocation create a option to convert time.Time values into loc before encoding
+// e.g. WithTimeLocation(time.UTC) to always encode in UTC
+func WithTimeLocation(loc *time.Location) EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.timeLocation = loc
+	}
+}
+
+// WithArrayFormat create a option to set the default format of slices and arrays (default is ArrayFormatRepeat)
+// The `comma`, `bracket` and `index` tag options win over the default
+func WithArrayFormat(format ArrayFormat) EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.arrayFormat = listFormat(format)
+	}
+}
+
+// WithDelimiterPolicy create a option to handle elements of delimited lists (`comma`, `space`, `pipe`, `delim=`)
+// which contain the delimiter (default is DelimiterKeep)
+func WithDelimiterPolicy(policy DelimiterPolicy) EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.delimiterPolicy = policy
+	}
+}
+
+// WithConflictPolicy create a option to set how SetQuery, AppendToURL and NewRequest
+// merge the encoded params with the params already in the URL (default is ConflictReplace)
+func WithConflictPolicy(policy ConflictPolicy) EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.conflictPolicy = policy
+	}
+}
+
+// WithNestedFormat create a option to set the default format of nested structs and maps (default is NestedFormatBracket)
+// The `bracket`, `dot`, `colon` and `flat` tag options win over the default
+func WithNestedFormat(format NestedFormat) EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.nestedFormat = nestedFormat(format)
+	}
+}
+
+// WithSortedOutput create a option to sort the query of EncodeToString and AppendEncoded by key,
+// the output is the same as url.Values.Encode instead of following struct field order
+func WithSortedOutput() EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.sortedOutput = true
+	}
+}
+
+// WithSortedMapKeys create a option to emit map entries sorted by their encoded key instead of map iteration order
+// Use the `sorted` tag option to sort the entries of a single map field
+func WithSortedMapKeys() EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.sortedMapKeys = true
+	}
+}
+
+// WithStringer create a option to encode types implementing fmt.Stringer with their String method
+// It is used as fallback when a type implements neither QueryParamEncoder nor encoding.TextMarshaler
+func WithStringer() EncoderOption {
+	return func(encoder *Encoder) {
+		encoder.useStringer = true
+	}
+}
+
+// WithCustomType create a option to encode a type with fnc, useful for third-party types which cannot implement QueryParamEncoder
+// typ is either a reflect.Type or a sample value of the type, e.g. uuid.UUID{}
+// Registered types take precedence over every other encoding rule, pointers to them are dereferenced before calling fnc
+func WithCustomType(typ interface{}, fnc func(reflect.Value) (string, error)) EncoderOption {
+	return func(encoder *Encoder) {
+		t, ok := typ.(reflect.Type)
+		if !ok {
+			t = reflect.TypeOf(typ)
+		}
+		if t == nil || fnc == nil {
+			return
+		}
+		if encoder.customTypes == nil {
+			encoder.customTypes = make(map[reflect.Type]func(reflect.Value) (string, error))
+		}
+		encoder.customTypes[t] = fnc
+	}
+}
+
 // NewEncoder init new *Encoder instance
 // Use EncoderOption to apply options
 func NewEncoder(options ...EncoderOption) *Encoder {
@@ -63,48 +205,176 @@ func NewEncoder(options ...EncoderOption) *Encoder {
 		for i := 0; i < tagSize; i++ {
 			tags = append(tags, make([]byte, 0, 56))
 		}
-		return &encoder{
-			e:     e,
-			tags:  tags,
-			scope: make([]byte, 0, 64),
+		enc := &encoder{
+			e:    e,
+			tags: tags,
 		}
+		enc.result = func(name string, val string, file ...*File) {
+			switch {
+			case enc.collectParts:
+				part := formPart{name: name, val: val}
+				if len(file) > 0 {
+					part.file = file[0]
+				}
+				enc.parts = append(enc.parts, part)
+			case enc.target != nil:
+				enc.target[name] = append(enc.target[name], val)
+			case enc.collectPairs:
+				enc.pairs = append(enc.pairs, Pair{Key: name, Value: val})
+			default:
+				enc.out = appendPair(enc.out, name, val)
+			}
+		}
+		return enc
 	}}
 
 	return e
 }
 
-// Values encodes a struct into url.Values
-// v must be struct data type
+// Values encodes a struct or map into url.Values
+// v must be struct or map data type
 func (e *Encoder) Values(v interface{}) (url.Values, error) {
-	val := reflect.ValueOf(v)
-	for val.Kind() == reflect.Ptr {
-		if val.IsNil() {
-			return nil, InvalidInputErr{InputKind: val.Kind()}
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	values := make(url.Values)
+	if err := enc.encode(v, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Encode encodes a struct or map into the given url.Values, values is left unchanged on error
+// v must be struct or map data type
+func (e *Encoder) Encode(v interface{}, values url.Values) error {
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	enc.resetValues()
+	if err := enc.encode(v, enc.values); err != nil {
+		return err
+	}
+	for key, vals := range enc.values {
+		if len(vals) > 0 {
+			values[key] = append(values[key], vals...)
 		}
-		val = val.Elem()
 	}
+	return nil
+}
 
-	switch val.Kind() {
-	case reflect.Invalid:
-		return nil, InvalidInputErr{InputKind: val.Kind()}
-	case reflect.Struct:
-		enc := e.dataPool.Get().(*encoder)
-		enc.values = make(url.Values)
-		err := enc.encodeStruct(val, enc.values, nil)
-		if err != nil {
-			return nil, err
+// AppendQuery appends the URL encoded form of v ("bar=baz&foo=quux") sorted by key to dst,
+// the output is the same as url.Values.Encode, pairs are joined to a non-empty dst with '&' unless it ends with '?' or '&'
+// v must be struct or map data type
+// Buffers are pooled, encoding basic types into a reused dst does not allocate
+func (e *Encoder) AppendQuery(dst []byte, v interface{}) ([]byte, error) {
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	enc.resetValues()
+	if err := enc.encode(v, enc.values); err != nil {
+		return dst, err
+	}
+	return enc.appendValues(dst), nil
+}
+
+// Pair is a query param with its key
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// Pairs is a list of query params which keeps the order they were encoded in
+type Pairs []Pair
+
+// Encode encodes the pairs into a URL encoded query ("foo=quux&bar=baz") keeping their order
+func (pairs Pairs) Encode() string {
+	var buf []byte
+	for _, pair := range pairs {
+		buf = appendPair(buf, pair.Key, pair.Value)
+	}
+	return string(buf)
+}
+
+// Values converts the pairs into url.Values, values of the same key keep their order
+func (pairs Pairs) Values() url.Values {
+	values := make(url.Values, len(pairs))
+	for _, pair := range pairs {
+		values[pair.Key] = append(values[pair.Key], pair.Value)
+	}
+	return values
+}
+
+// Pairs encodes a struct or map into Pairs, keeping struct field order and slice order
+// Map entries follow map iteration order, use WithSortedMapKeys to sort them by key
+// v must be struct or map data type
+func (e *Encoder) Pairs(v interface{}) (Pairs, error) {
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	enc.collectPairs = true
+	err := enc.encode(v, nil)
+	pairs := enc.pairs
+	enc.collectPairs, enc.pairs = false, nil
+	if err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// EncodeToString encodes a struct or map into a URL encoded query ("foo=quux&bar=baz") in struct field order
+// v must be struct or map data type
+// Use WithSortedOutput to sort the query by key like url.Values.Encode
+func (e *Encoder) EncodeToString(v interface{}) (string, error) {
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	out, err := enc.appendEncoded(enc.out[:0], v)
+	if cap(out) <= maxPooledBytes {
+		enc.out = out[:0]
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// AppendEncoded appends the URL encoded query of v to dst in struct field order, without building url.Values
+// pairs are joined to a non-empty dst with '&' unless it ends with '?' or '&'
+// v must be struct or map data type
+// Use WithSortedOutput to sort the query by key like url.Values.Encode
+func (e *Encoder) AppendEncoded(dst []byte, v interface{}) ([]byte, error) {
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	return enc.appendEncoded(dst, v)
+}
+
+func (e *encoder) appendEncoded(dst []byte, v interface{}) ([]byte, error) {
+	if e.e.sortedOutput {
+		e.resetValues()
+		if err := e.encode(v, e.values); err != nil {
+			return dst, err
 		}
-		values := enc.values
-		e.dataPool.Put(enc)
-		return values, nil
-	default:
-		return nil, InvalidInputErr{InputKind: val.Kind()}
+		return e.appendValues(dst), nil
+	}
+
+	n := len(dst)
+	e.out = dst
+	err := e.encode(v, nil)
+	dst, e.out = e.out, nil
+	if err != nil {
+		return dst[:n], err
 	}
+	return dst, nil
 }
 
-// Encode encodes a struct into the given url.Values
-// v must be struct data type
-func (e *Encoder) Encode(v interface{}, values url.Values) error {
+// encode encodes v into values, or into e.pairs or e.out if values is nil
+func (e *encoder) encode(v interface{}, values url.Values) error {
+	e.target = values
+	defer func() {
+		e.target = nil
+	}()
+
 	val := reflect.ValueOf(v)
 	for val.Kind() == reflect.Ptr {
 		if val.IsNil() {
@@ -114,20 +384,72 @@ func (e *Encoder) Encode(v interface{}, values url.Values) error {
 	}
 
 	switch val.Kind() {
-	case reflect.Invalid:
-		return InvalidInputErr{InputKind: val.Kind()}
 	case reflect.Struct:
-		enc := e.dataPool.Get().(*encoder)
-		err := enc.encodeStruct(val, values, nil)
-		if err != nil {
-			return err
-		}
-		return nil
+		return e.encodeStruct(val, values, nil)
+	case reflect.Map:
+		return e.encodeMap(val, values)
 	default:
 		return InvalidInputErr{InputKind: val.Kind()}
 	}
 }
 
+// resetValues empties the pooled url.Values, keeping the allocated keys and slices for reuse
+func (e *encoder) resetValues() {
+	if e.values == nil || len(e.values) > maxPooledKeys {
+		e.values = make(url.Values)
+		return
+	}
+	for key, vals := range e.values {
+		e.values[key] = vals[:0]
+	}
+}
+
+// appendValues appends the pooled url.Values sorted by key to dst
+func (e *encoder) appendValues(dst []byte) []byte {
+	e.keys = e.keys[:0]
+	for key, vals := range e.values {
+		if len(vals) > 0 {
+			e.keys = append(e.keys, key)
+		}
+	}
+	sort.Strings(e.keys)
+
+	for _, key := range e.keys {
+		for _, val := range e.values[key] {
+			dst = appendPair(dst, key, val)
+		}
+	}
+	return dst
+}
+
+// appendPair appends the escaped name=val pair to dst, joined with '&' unless dst is empty or ends with '?' or '&'
+func appendPair(dst []byte, name string, val string) []byte {
+	if len(dst) > 0 && dst[len(dst)-1] != '?' && dst[len(dst)-1] != '&' {
+		dst = append(dst, '&')
+	}
+	dst = appendQueryEscape(dst, name)
+	dst = append(dst, '=')
+	return appendQueryEscape(dst, val)
+}
+
+// appendQueryEscape appends s escaped like url.QueryEscape to dst
+func appendQueryEscape(dst []byte, s string) []byte {
+	const upperHex = "0123456789ABCDEF"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			dst = append(dst, c)
+		case c == ' ':
+			dst = append(dst, '+')
+		default:
+			dst = append(dst, '%', upperHex[c>>4], upperHex[c&15])
+		}
+	}
+	return dst
+}
+
 func (e *encoder) encodeStruct(stVal reflect.Value, values url.Values, scope []byte) error {
 	stTyp := stVal.Type()
 
@@ -136,12 +458,20 @@ func (e *encoder) encodeStruct(stVal reflect.Value, values url.Values, scope []b
 	if cachedFlds == nil {
 		cachedFlds = make(cachedFields, 0, stTyp.NumField())
 		e.structCaching(&cachedFlds, nestedFormatBracket, scope, stVal)
+		// Another goroutine may have cached the type first, use the stored fields
 		e.e.cache.Store(stTyp, cachedFlds)
+		cachedFlds = e.e.cache.Retrieve(stTyp)
 	}
 
+	var invalid ValidationErrors
 	for i, cachedFld := range cachedFlds {
 		stFldVal := stVal.Field(i)
 
+		if cachedFld != nil {
+			stFldVal = cachedFld.withDefault(stFldVal)
+			invalid = cachedFld.validate(stFldVal, stTyp.Field(i).Name, invalid)
+		}
+
 		switch cachedFld := cachedFld.(type) {
 		case nil:
 			// skip field
@@ -165,7 +495,7 @@ func (e *encoder) encodeStruct(stVal reflect.Value, values url.Values, scope []b
 				//data type is not supported
 				continue
 			}
-			if cachedFld.arrayFormat <= arrayFormatBracket {
+			if cachedFld.arrayFormat <= arrayFormatBracket && !cachedFld.nested {
 				// With cachedFld type is slice/array, only accept non-nil value
 				for stFldVal.Kind() == reflect.Ptr {
 					stFldVal = stFldVal.Elem()
@@ -176,101 +506,219 @@ func (e *encoder) encodeStruct(stVal reflect.Value, values url.Values, scope []b
 				if stFldVal.Len() == 0 {
 					continue
 				}
-				if count := countElem(stFldVal); count > 0 {
-					// preallocate slice
-					values[cachedFld.name] = make([]string, 0, countElem(stFldVal))
-				} else {
+				count := countElem(stFldVal)
+				if count == 0 {
 					continue
 				}
+				// preallocate slice, keeping values already encoded under the name
+				if vals := values[cachedFld.name]; values != nil && cap(vals)-len(vals) < count {
+					values[cachedFld.name] = append(make([]string, 0, len(vals)+count), vals...)
+				}
 			}
 		}
 
 		// format value
-		err := cachedFld.formatFnc(stFldVal, func(name string, val string) {
-			values[name] = append(values[name], val)
-		})
+		err := cachedFld.formatFnc(stFldVal, e.result)
 		if err != nil {
-			return err
+			err = wrapEncodeError(err, stTyp.Field(i).Name, nil)
+			if invalid, err = collectInvalid(invalid, err); err != nil {
+				return err
+			}
 		}
 	}
-	return nil
+	return invalid.errOrNil()
+}
+
+// encodeMap encodes a top-level map, each entry is encoded as key=value
+// and nested maps/structs are scoped under their key with brackets
+func (e *encoder) encodeMap(mapVal reflect.Value, values url.Values) error {
+	mapTyp := mapVal.Type()
+
+	cachedFlds := e.e.cache.Retrieve(mapTyp)
+
+	if cachedFlds == nil {
+		cachedFlds = cachedFields{e.newMapField(mapTyp.Key(), mapTyp.Elem(), nil, nil)}
+		e.e.cache.Store(mapTyp, cachedFlds)
+		cachedFlds = e.e.cache.Retrieve(mapTyp)
+	}
+
+	mapFld := cachedFlds[0].(*mapField)
+	if mapFld.cachedKeyField == nil || mapFld.cachedValueField == nil {
+		//data type is not supported
+		return nil
+	}
+
+	return mapFld.formatFnc(mapVal, e.result)
 }
 
 func (e *encoder) structCaching(fields *cachedFields, notation nestedFormat, scope []byte, stVal reflect.Value) {
+	e.cacheStructFields(fields, notation, scope, stVal)
+	hideShadowedFields(*fields, getType(stVal), e.e.tagAlias)
+}
+
+// cacheStructFields caches the fields of a struct, fields of embedded structs are cached
+// under the same scope without applying Go's shadowing rules
+func (e *encoder) cacheStructFields(fields *cachedFields, notation nestedFormat, scope []byte, stVal reflect.Value) {
 
 	structTyp := getType(stVal)
 
+	// Validation rules and defaults are parsed with the tag options and set once the fields are created
+	start := len(*fields)
+	var rules map[int]*fieldRules
+	var defaults map[int]reflect.Value
+	defer func() {
+		for i, fldRules := range rules {
+			if field := (*fields)[start+i]; field != nil {
+				field.setRules(fldRules)
+			}
+		}
+		for i, defaultValue := range defaults {
+			if field := (*fields)[start+i]; field != nil {
+				field.setDefault(defaultValue)
+			}
+		}
+	}()
+
 	for i := 0; i < structTyp.NumField(); i++ {
 
 		structField := structTyp.Field(i)
 
-		if structField.PkgPath != "" && !structField.Anonymous { // unexported field
+		if structField.PkgPath != "" && !isEmbeddedStruct(structField) { // unexported field
 			*fields = append(*fields, nil)
 			continue
 		}
 
+		// Embedded structs without tag name are flattened like encoding/json
+		flatten := isEmbeddedStruct(structField) && !hasTagName(structField, e.e.tagAlias)
+
 		e.getTagNameAndOpts(structField)
 
+		// OpenAPI style and explode options are mapped onto the list and nested formats
+		objectDelimiter := e.applyStyle(structField.Type)
+
+		if fldRules := rulesFromOptions(e.tags[1:]); fldRules != nil {
+			if rules == nil {
+				rules = make(map[int]*fieldRules)
+			}
+			rules[i] = fldRules
+		}
+
+		if hasDefaultOption(e.tags[1:]) {
+			options := optionStrings(e.tags[1:])
+			if timeOption := timeFormatOption(e.e.timeFormat, e.e.timeLayout); timeOption != "" {
+				// The default is written in the time format of the encoder unless the field sets its own
+				options = append([]string{timeOption}, options...)
+			}
+			if defaultValue, err := parseDefault(structField.Type, options); err == nil {
+				if defaults == nil {
+					defaults = make(map[int]reflect.Value)
+				}
+				defaults[i] = defaultValue
+			} else {
+				// malformed defaults are reported like malformed validation rules
+				if rules == nil {
+					rules = make(map[int]*fieldRules)
+				}
+				if rules[i] == nil {
+					rules[i] = &fieldRules{}
+				}
+				str, _ := defaultOption(options)
+				rules[i].malformed = append(rules[i].malformed, "default="+str)
+			}
+		}
+
+		// Structs with the flat option are flattened as well
+		flatten = flatten || nestedFormatFromOptions(e.tags[1:]) == nestedFormatFlat
+
 		if string(e.tags[0]) == "-" { // ignored field
+			*fields = append(*fields, nil)
 			continue
 		}
 
 		if string(scope) != "" {
-			scopedName := strings.Builder{}
-			switch notation {
-			case nestedFormatDot:
-				scopedName.Write(scope)
-				scopedName.WriteRune('.')
-				scopedName.Write(e.tags[0])
-			default:
-				scopedName.Write(scope)
-				scopedName.WriteRune('[')
-				scopedName.Write(e.tags[0])
-				scopedName.WriteRune(']')
-			}
-
-			e.tags[0] = e.tags[0][:0]
-			e.tags[0] = append(e.tags[0], scopedName.String()...)
+			scopedName := scopedKey(string(scope), string(e.tags[0]), notation)
+			e.tags[0] = append(e.tags[0][:0], scopedName...)
 		}
 
 		fieldVal := stVal.Field(i)
 
+		if registeredTyp, fnc, ok := e.e.customTypeOf(fieldVal.Type()); ok {
+			*fields = append(*fields, newRegisteredField(registeredTyp, fnc, e.tags[0], e.tags[1:]))
+			continue
+		}
+
 		if fieldVal.Type().Implements(encoderType) {
 			*fields = append(*fields, newCustomField(fieldVal.Type(), e.tags[0], e.tags[1:]))
 			continue
 		}
 
+		if fieldVal.Type().Implements(valuesType) {
+			*fields = append(*fields, newValuesField(fieldVal.Type(), e.tags[0], e.tags[1:]))
+			continue
+		}
+
+		if isFileType(fieldVal.Type()) {
+			*fields = append(*fields, newFileField(e.tags[0], e.tags[1:]))
+			continue
+		}
+
 		fieldTyp := getType(fieldVal)
 
 		if fieldTyp == timeType {
-			*fields = append(*fields, newTimeField(e.tags[0], e.tags[1:]))
+			*fields = append(*fields, e.newTimeField(e.tags[0], e.tags[1:]))
+			continue
+		}
+
+		if fieldTyp == durationType {
+			*fields = append(*fields, newDurationField(e.tags[0], e.tags[1:]))
+			continue
+		}
+
+		if format, ok := e.e.textFormatOf(fieldVal.Type()); ok {
+			*fields = append(*fields, newTextField(fieldVal.Type(), format, e.tags[0], e.tags[1:]))
+			continue
+		}
+
+		if objectDelimiter != "" {
+			*fields = append(*fields, e.newObjectField(fieldTyp, objectDelimiter, e.tags[0], e.tags[1:]))
 			continue
 		}
 
 		switch fieldTyp.Kind() {
 		case reflect.Struct:
 			fieldVal = reflect.Zero(fieldTyp)
-			// Clear and set new scope
-			e.scope = e.scope[:0]
-			e.scope = append(e.scope, e.tags[0]...)
+			if flatten {
+				// Promote the fields of the embedded struct to the current scope
+				field := newEmbedField(fieldVal.NumField(), scope, e.tags[1:])
+				field.flatten = true
+				*fields = append(*fields, field)
+				e.cacheStructFields(&field.cachedFields, notation, scope, fieldVal)
+				continue
+			}
+			// New scope, the tag buffers are reused while caching children
+			childScope := append([]byte(nil), e.tags[0]...)
 			// How this struct's children should be scoped under its name
-			childNotation := nestedFormatFromOptions(e.tags[1:])
+			childNotation := e.e.notationOf(e.tags[1:])
 			// New embed field
 			field := newEmbedField(fieldVal.NumField(), e.tags[0], e.tags[1:])
 			*fields = append(*fields, field)
 			// Recursive
-			e.structCaching(&field.cachedFields, childNotation, e.scope, fieldVal)
+			e.structCaching(&field.cachedFields, childNotation, childScope, fieldVal)
 		case reflect.Slice, reflect.Array:
 			//Slice element type
 			elemType := fieldTyp.Elem()
-			if elemType.Implements(encoderType) {
-				*fields = append(*fields, e.newListField(elemType, e.tags[0], e.tags[1:]))
-				continue
+			if !e.e.isCustomType(elemType) {
+				for elemType.Kind() == reflect.Ptr {
+					elemType = elemType.Elem()
+				}
 			}
-			for elemType.Kind() == reflect.Ptr {
-				elemType = elemType.Elem()
+			field := e.newListField(elemType, e.tags[0], e.tags[1:])
+			if field.cachedField == nil {
+				//data type is not supported
+				*fields = append(*fields, nil)
+				continue
 			}
-			*fields = append(*fields, e.newListField(elemType, e.tags[0], e.tags[1:]))
+			*fields = append(*fields, field)
 		case reflect.Map:
 			keyType := fieldTyp.Key()
 			/*for keyType.Kind() == reflect.Ptr {
@@ -280,7 +728,24 @@ func (e *encoder) structCaching(fields *cachedFields, notation nestedFormat, sco
 			/*for valueType.Kind() == reflect.Ptr {
 				valueType = valueType.Elem()
 			}*/
-			*fields = append(*fields, newMapField(keyType, valueType, e.tags[0], e.tags[1:]))
+			flat := nestedFormatFromOptions(e.tags[1:]) == nestedFormatFlat
+			var field *mapField
+			if flat {
+				// Promote the entries of the map to the current scope
+				field = e.newMapField(keyType, valueType, scope, e.tags[1:])
+				field.notation = notation
+				field.flat = true
+			} else {
+				field = e.newMapField(keyType, valueType, e.tags[0], e.tags[1:])
+			}
+			if field.cachedKeyField == nil || field.cachedValueField == nil {
+				//data type is not supported
+				*fields = append(*fields, nil)
+				continue
+			}
+			*fields = append(*fields, field)
+		case reflect.Interface:
+			*fields = append(*fields, e.newInterfaceField(e.tags[0], e.tags[1:]))
 		default:
 			*fields = append(*fields, newCachedFieldByKind(fieldTyp.Kind(), e.tags[0], e.tags[1:]))
 		}
@@ -288,12 +753,35 @@ func (e *encoder) structCaching(fields *cachedFields, notation nestedFormat, sco
 }
 
 func nestedFormatFromOptions(tagOptions [][]byte) nestedFormat {
+	if notation, ok := nestedFormatOption(tagOptions); ok {
+		return notation
+	}
+	return nestedFormatBracket
+}
+
+// nestedFormatOption returns the nested format given by the tag options
+func nestedFormatOption(tagOptions [][]byte) (nestedFormat, bool) {
 	for _, tagOption := range tagOptions {
-		if string(tagOption) == "dot" {
-			return nestedFormatDot
+		switch string(tagOption) {
+		case "bracket":
+			return nestedFormatBracket, true
+		case "dot":
+			return nestedFormatDot, true
+		case "colon":
+			return nestedFormatColon, true
+		case "flat":
+			return nestedFormatFlat, true
 		}
 	}
-	return nestedFormatBracket
+	return 0, false
+}
+
+// notationOf returns the nested format given by the tag options, or the default format of the encoder
+func (e *Encoder) notationOf(tagOptions [][]byte) nestedFormat {
+	if notation, ok := nestedFormatOption(tagOptions); ok {
+		return notation
+	}
+	return e.nestedFormat
 }
 
 func (e *encoder) getTagNameAndOpts(f reflect.StructField) {
@@ -312,6 +800,9 @@ func (e *encoder) getTagNameAndOpts(f reflect.StructField) {
 		e.tags[0] = append(e.tags[0][:0], tag...)
 
 		splitTags := strings.Split(tag, ",")
+		if cap(e.tags) < len(splitTags) {
+			e.tags = append(e.tags[:cap(e.tags)], make([][]byte, len(splitTags)-cap(e.tags))...)
+		}
 		e.tags = e.tags[:len(splitTags)]
 
 		for i := 0; i < len(splitTags); i++ {
@@ -325,3 +816,39 @@ func (e *encoder) getTagNameAndOpts(f reflect.StructField) {
 		}
 	}
 }
+
+// applyStyle rewrites the OpenAPI style and explode options in the tag buffers for a field of type typ,
+// it returns the delimiter of structs and maps serialized as a single value
+func (e *encoder) applyStyle(typ reflect.Type) string {
+	options := optionStrings(e.tags[1:])
+	if !hasStyleOption(options) {
+		return ""
+	}
+	derefTyp := derefType(typ)
+	custom := e.e.isCustomType(typ) || derefTyp == timeType || derefTyp == durationType
+	options, objectDelimiter := styleOptions(derefTyp, custom, options)
+	e.tags = e.tags[:1]
+	for _, option := range options {
+		e.tags = append(e.tags, []byte(option))
+	}
+	return objectDelimiter
+}
+
+// optionStrings copies the tag options out of the reused tag buffers
+func optionStrings(tagOptions [][]byte) []string {
+	options := make([]string, 0, len(tagOptions))
+	for _, tagOption := range tagOptions {
+		options = append(options, string(tagOption))
+	}
+	return options
+}
+
+// hasDefaultOption reports whether the tag options contain the `default=` option
+func hasDefaultOption(tagOptions [][]byte) bool {
+	for _, tagOption := range tagOptions {
+		if bytes.HasPrefix(tagOption, []byte("default=")) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package qs
 
 import (
 	"reflect"
+	"strings"
 	"sync"
 )
 
@@ -18,6 +19,8 @@ func newCacheStore() *cacheStore {
 
 // Retrieve cachedFields corresponding to reflect.Type
 func (cacheStore *cacheStore) Retrieve(typ reflect.Type) cachedFields {
+	cacheStore.mutex.RLock()
+	defer cacheStore.mutex.RUnlock()
 	return cacheStore.m[typ]
 }
 
@@ -31,23 +34,127 @@ func (cacheStore *cacheStore) Store(typ reflect.Type, cachedFields cachedFields)
 }
 
 type (
-	resultFunc func(name string, val string)
+	// resultFunc receives the encoded params, file is only passed by file fields
+	// and must be forwarded by fields scoping the keys of their children
+	resultFunc func(name string, val string, file ...*File)
 
 	// cachedField
 	cachedField interface {
 		formatFnc(value reflect.Value, result resultFunc) error
+		// validate appends the validation errors of value to invalid, implemented by baseField
+		validate(value reflect.Value, path string, invalid ValidationErrors) ValidationErrors
+		setRules(rules *fieldRules)
+		// withDefault returns the default value of the field for nil and zero values, implemented by baseField
+		withDefault(value reflect.Value) reflect.Value
+		setDefault(value reflect.Value)
 	}
 
 	cachedFields []cachedField
 )
 
-func newCacheFieldByType(typ reflect.Type, tagName []byte, tagOptions [][]byte) cachedField {
+// textFormatOf tells whether typ is encoded by encoding.TextMarshaler or fmt.Stringer
+// Both have lower precedence than QueryParamEncoder, time.Time and time.Duration
+func (e *Encoder) textFormatOf(typ reflect.Type) (textFormat, bool) {
+	if base := derefType(typ); base == timeType || base == durationType {
+		return 0, false
+	}
+	if implementsOrPtr(typ, textMarshalerType) {
+		return textFormatMarshaler, true
+	}
+	if e.useStringer && implementsOrPtr(typ, stringerType) {
+		return textFormatStringer, true
+	}
+	return 0, false
+}
+
+// implementsOrPtr reports whether typ implements iface, with pointer receivers for non-pointer types like big.Int
+func implementsOrPtr(typ reflect.Type, iface reflect.Type) bool {
+	if typ.Implements(iface) {
+		return true
+	}
+	return typ.Kind() != reflect.Ptr && typ.Kind() != reflect.Interface && reflect.PtrTo(typ).Implements(iface)
+}
+
+// customTypeOf returns the type registered by WithCustomType which typ or the types it points to match
+func (e *Encoder) customTypeOf(typ reflect.Type) (reflect.Type, func(reflect.Value) (string, error), bool) {
+	if len(e.customTypes) == 0 {
+		return nil, nil, false
+	}
+	for {
+		if fnc, ok := e.customTypes[typ]; ok {
+			return typ, fnc, true
+		}
+		if typ.Kind() != reflect.Ptr {
+			return nil, nil, false
+		}
+		typ = typ.Elem()
+	}
+}
+
+// isCustomType reports whether typ encodes itself,
+// pointers to such types must not be dereferenced before encoding
+func (e *Encoder) isCustomType(typ reflect.Type) bool {
+	if _, _, ok := e.customTypeOf(typ); ok {
+		return true
+	}
+	if typ.Implements(encoderType) || typ.Implements(valuesType) || isFileType(typ) {
+		return true
+	}
+	_, ok := e.textFormatOf(typ)
+	return ok
+}
+
+func (e *encoder) newCacheFieldByType(typ reflect.Type, tagName []byte, tagOptions [][]byte) cachedField {
+	if registeredTyp, fnc, ok := e.e.customTypeOf(typ); ok {
+		return newRegisteredField(registeredTyp, fnc, tagName, tagOptions)
+	}
 	if typ.Implements(encoderType) {
 		return newCustomField(typ, tagName, tagOptions)
 	}
-	switch typ {
-	case timeType:
-		return newTimeField(tagName, tagOptions)
+	if typ.Implements(valuesType) {
+		return newValuesField(typ, tagName, tagOptions)
+	}
+	if isFileType(typ) {
+		return newFileField(tagName, tagOptions)
+	}
+	if typ == timeType {
+		return e.newTimeField(tagName, tagOptions)
+	}
+	if typ == durationType {
+		return newDurationField(tagName, tagOptions)
+	}
+	if format, ok := e.e.textFormatOf(typ); ok {
+		return newTextField(typ, format, tagName, tagOptions)
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		// Children of an unnamed struct are scoped by its container at encoding time
+		field := newEmbedField(typ.NumField(), tagName, tagOptions)
+		scope := append([]byte(nil), tagName...)
+		e.structCaching(&field.cachedFields, e.e.notationOf(tagOptions), scope, reflect.Zero(typ))
+		return field
+	case reflect.Slice, reflect.Array:
+		elemTyp := typ.Elem()
+		if !e.e.isCustomType(elemTyp) {
+			for elemTyp.Kind() == reflect.Ptr {
+				elemTyp = elemTyp.Elem()
+			}
+		}
+		field := e.newListField(elemTyp, tagName, tagOptions)
+		if field.cachedField == nil {
+			//data type is not supported
+			return nil
+		}
+		return field
+	case reflect.Map:
+		field := e.newMapField(typ.Key(), typ.Elem(), tagName, tagOptions)
+		if field.cachedKeyField == nil || field.cachedValueField == nil {
+			//data type is not supported
+			return nil
+		}
+		return field
+	case reflect.Interface:
+		return e.newInterfaceField(tagName, tagOptions)
 	default:
 		return newCachedFieldByKind(typ.Kind(), tagName, tagOptions)
 	}
@@ -71,10 +178,6 @@ func newCachedFieldByKind(kind reflect.Kind, tagName []byte, tagOptions [][]byte
 		return newComplex64Field(tagName, tagOptions)
 	case reflect.Complex128:
 		return newComplex128Field(tagName, tagOptions)
-	case reflect.Struct:
-		return newEmbedField(0, tagName, tagOptions)
-	case reflect.Interface:
-		return newInterfaceField(tagName, tagOptions)
 	default:
 		return nil
 	}
@@ -102,3 +205,241 @@ func countElem(value reflect.Value) int {
 	}
 	return count
 }
+
+// isEmbeddedStruct reports whether f is an embedded struct or pointer to struct
+func isEmbeddedStruct(f reflect.StructField) bool {
+	return f.Anonymous && derefType(f.Type).Kind() == reflect.Struct
+}
+
+// hasTagName reports whether the tag of f gives a name explicitly
+func hasTagName(f reflect.StructField, tagAlias string) bool {
+	tag := f.Tag.Get(tagAlias)
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag != ""
+}
+
+// promotedField describes a field which may be promoted from embedded structs
+type promotedField struct {
+	name   string
+	depth  int
+	tagged bool
+}
+
+// hiddenFields applies Go's shadowing rules to fields sharing a name:
+// the shallowest field wins, a tagged field wins a tie, other ties hide each other
+func hiddenFields(fields []promotedField) []bool {
+	byName := make(map[string][]int, len(fields))
+	for i, field := range fields {
+		byName[field.name] = append(byName[field.name], i)
+	}
+	hidden := make([]bool, len(fields))
+	for _, indexes := range byName {
+		if len(indexes) == 1 {
+			continue
+		}
+		dominant, ok := dominantField(fields, indexes)
+		for _, i := range indexes {
+			hidden[i] = !ok || i != dominant
+		}
+	}
+	return hidden
+}
+
+func dominantField(fields []promotedField, indexes []int) (int, bool) {
+	shallowest := make([]int, 0, len(indexes))
+	for _, i := range indexes {
+		switch {
+		case len(shallowest) == 0 || fields[i].depth == fields[shallowest[0]].depth:
+			shallowest = append(shallowest, i)
+		case fields[i].depth < fields[shallowest[0]].depth:
+			shallowest = append(shallowest[:0], i)
+		}
+	}
+	if len(shallowest) == 1 {
+		return shallowest[0], true
+	}
+	dominant, tagged := 0, 0
+	for _, i := range shallowest {
+		if fields[i].tagged {
+			dominant = i
+			tagged++
+		}
+	}
+	return dominant, tagged == 1
+}
+
+// hideShadowedFields replaces fields shadowed by Go's rules for embedded structs with nil
+func hideShadowedFields(fields cachedFields, typ reflect.Type, tagAlias string) {
+	var promoted []promotedField
+	var slots []*cachedField
+	hasEmbedded := false
+
+	var collect func(fields cachedFields, typ reflect.Type, depth int)
+	collect = func(fields cachedFields, typ reflect.Type, depth int) {
+		for i, field := range fields {
+			if field == nil {
+				continue
+			}
+			if mapField, ok := field.(*mapField); ok && mapField.flat {
+				// entries of flat maps are not fields
+				continue
+			}
+			if embedField, ok := field.(*embedField); ok && embedField.flatten {
+				hasEmbedded = true
+				collect(embedField.cachedFields, derefType(typ.Field(i).Type), depth+1)
+				continue
+			}
+			namedField, ok := field.(interface{ fieldName() string })
+			if !ok {
+				continue
+			}
+			promoted = append(promoted, promotedField{
+				name:   namedField.fieldName(),
+				depth:  depth,
+				tagged: hasTagName(typ.Field(i), tagAlias),
+			})
+			slots = append(slots, &fields[i])
+		}
+	}
+	collect(fields, typ, 0)
+
+	if !hasEmbedded {
+		return
+	}
+	for i, hidden := range hiddenFields(promoted) {
+		if hidden {
+			*slots[i] = nil
+		}
+	}
+}
+
+// joinKey scopes the key produced by an unnamed field under scope with brackets,
+// e.g. scope "filter" and key "user[name]" results in "filter[user][name]"
+func joinKey(scope string, key string) string {
+	if len(scope) == 0 {
+		return key
+	}
+	if len(key) == 0 {
+		return scope
+	}
+	switch i := strings.IndexAny(key, "[."); {
+	case i < 0:
+		return scope + "[" + key + "]"
+	case i == 0:
+		return scope + key
+	default:
+		return scope + "[" + key[:i] + "]" + key[i:]
+	}
+}
+
+// joinKeyWith scopes the key produced by an unnamed field under scope with the notation,
+// e.g. scope "filter" and key "user[name]" results in "filter.user[name]" with the dot notation
+func joinKeyWith(scope string, key string, notation nestedFormat) string {
+	if notation == nestedFormatBracket || len(scope) == 0 || len(key) == 0 {
+		return joinKey(scope, key)
+	}
+	switch i := strings.IndexAny(key, "[."); {
+	case i < 0:
+		return scopedKey(scope, key, notation)
+	case i == 0:
+		return scope + key
+	default:
+		return scopedKey(scope, key[:i], notation) + key[i:]
+	}
+}
+
+// nestingOptions returns a copy of the layout options (list and nested formats, sorted map keys)
+// which apply to a nested list, map or struct of type typ
+func nestingOptions(typ reflect.Type, tagOptions [][]byte) [][]byte {
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+	default:
+		return nil
+	}
+	if typ == timeType || typ.Implements(encoderType) || typ.Implements(valuesType) {
+		return nil
+	}
+	options := make([][]byte, 0, len(tagOptions))
+	for _, tagOption := range tagOptions {
+		switch string(tagOption) {
+		case "repeat", "comma", "bracket", "index", "dot", "colon", tagSorted:
+			options = append(options, append([]byte(nil), tagOption...))
+		}
+	}
+	return options
+}
+
+// hasStyleOption reports whether the options contain the OpenAPI `style=` or `explode=` options
+func hasStyleOption(options []string) bool {
+	for _, option := range options {
+		if strings.HasPrefix(option, "style=") || strings.HasPrefix(option, "explode=") {
+			return true
+		}
+	}
+	return false
+}
+
+// styleOptions maps the OpenAPI `style=` and `explode=` options of a field of type typ onto
+// the list and nested format options, custom is set for types encoded as a single value.
+// objectDelimiter is returned for structs and maps serialized as one delimited value
+func styleOptions(typ reflect.Type, custom bool, options []string) (mapped []string, objectDelimiter string) {
+	style, explode, explodeSet := "form", false, false
+	mapped = make([]string, 0, len(options))
+	for _, option := range options {
+		switch {
+		case strings.HasPrefix(option, "style="):
+			style = option[len("style="):]
+		case strings.HasPrefix(option, "explode="):
+			explode, explodeSet = option == "explode=true", true
+		default:
+			mapped = append(mapped, option)
+		}
+	}
+	if !explodeSet {
+		// Only the form style explodes by default
+		explode = style == "form"
+	}
+
+	delimiter := ","
+	switch style {
+	case "form", "deepObject":
+	case "spaceDelimited":
+		delimiter = " "
+	case "pipeDelimited":
+		delimiter = "|"
+	default:
+		// Path and header styles do not apply to query strings
+		return mapped, ""
+	}
+
+	if custom {
+		return mapped, ""
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		switch {
+		case style == "deepObject":
+			// Lists are not defined for deepObject
+		case explode:
+			mapped = append(mapped, "repeat")
+		case style == "form":
+			mapped = append(mapped, "comma")
+		case style == "spaceDelimited":
+			mapped = append(mapped, "space")
+		default:
+			mapped = append(mapped, "pipe")
+		}
+	case reflect.Struct, reflect.Map:
+		switch {
+		case style == "deepObject":
+			mapped = append(mapped, "bracket")
+		case explode:
+			mapped = append(mapped, "flat")
+		default:
+			objectDelimiter = delimiter
+		}
+	}
+	return mapped, objectDelimiter
+}
@@ -1,7 +1,10 @@
 package qs
 
 import (
+	"net/url"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -71,3 +74,77 @@ func TestNewCacheField2(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestEncoderConcurrentUse(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type item struct {
+		Name string `qs:"name"`
+	}
+	type query struct {
+		ID    int               `qs:"id"`
+		Items []item            `qs:"items,index"`
+		Iface interface{}       `qs:"iface"`
+		Tags  map[string]string `qs:"tags"`
+	}
+	type other struct {
+		Iface interface{} `qs:"iface"`
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Same type with different dynamic types behind the interface field
+			var iface interface{} = i
+			if i%2 == 0 {
+				iface = item{Name: "even"}
+			}
+			values, err := encoder.Values(query{
+				ID:    i,
+				Items: []item{{Name: "a"}},
+				Iface: iface,
+				Tags:  map[string]string{"k": "v"},
+			})
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			expected := url.Values{
+				"id":             []string{strconv.Itoa(i)},
+				"items[0][name]": []string{"a"},
+				"tags[k]":        []string{"v"},
+			}
+			if i%2 == 0 {
+				expected["iface[name]"] = []string{"even"}
+			} else {
+				expected["iface"] = []string{strconv.Itoa(i)}
+			}
+			if !reflect.DeepEqual(expected, values) {
+				errs <- "expected " + expected.Encode() + ", got " + values.Encode()
+			}
+
+			// Different types sharing the encoder
+			values, err = encoder.Values(other{Iface: float64(i)})
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+			if values.Get("iface") != strconv.Itoa(i) {
+				errs <- "unexpected iface " + values.Get("iface")
+			}
+			if _, err = encoder.Values(map[string]int{"n": i}); err != nil {
+				errs <- err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
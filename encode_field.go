@@ -1,9 +1,14 @@
 package qs
 
 import (
+	"encoding"
+	"fmt"
+	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,34 +18,180 @@ const (
 	_ timeFormat = iota
 	timeFormatSecond
 	timeFormatMillis
+	timeFormatMicros
+	timeFormatNanos
+	timeFormatFracSecond // seconds with fractional part, 1580601600.123
+	timeFormatLayout
 )
 
+// timeLayouts maps the named layout options to time layouts
+var timeLayouts = map[string]string{
+	"date":        "2006-01-02",
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+}
+
+// timeFormatFromOption parses a time format option,
+// ok is false if the option is not a time format
+func timeFormatFromOption(option string) (format timeFormat, layout string, ok bool) {
+	switch option {
+	case "second":
+		return timeFormatSecond, "", true
+	case "millis":
+		return timeFormatMillis, "", true
+	case "micros":
+		return timeFormatMicros, "", true
+	case "nanos":
+		return timeFormatNanos, "", true
+	case "fracsecond":
+		return timeFormatFracSecond, "", true
+	}
+	if layout, ok := timeLayouts[option]; ok {
+		return timeFormatLayout, layout, true
+	}
+	if strings.HasPrefix(option, "layout=") {
+		return timeFormatLayout, option[len("layout="):], true
+	}
+	return 0, "", false
+}
+
+// timeFormatOption returns the tag option of a time format, it is empty for the default RFC3339 format
+func timeFormatOption(format timeFormat, layout string) string {
+	switch format {
+	case timeFormatSecond:
+		return "second"
+	case timeFormatMillis:
+		return "millis"
+	case timeFormatMicros:
+		return "micros"
+	case timeFormatNanos:
+		return "nanos"
+	case timeFormatFracSecond:
+		return "fracsecond"
+	case timeFormatLayout:
+		return "layout=" + layout
+	default:
+		return ""
+	}
+}
+
 type listFormat uint8
 
 const (
 	arrayFormatRepeat listFormat = iota
 	arrayFormatBracket
-	arrayFormatComma
+	arrayFormatComma // delimited by comma or the delimiter of the list
 	arrayFormatIndex
 )
 
+// delimiterFromOption returns the delimiter of the delimited list format given by a tag option:
+// `comma`, `space`, `pipe` or `delim=...`, escape sequences like `delim=\t` are interpreted
+func delimiterFromOption(option string) (string, bool) {
+	switch option {
+	case "comma":
+		return ",", true
+	case "space":
+		return " ", true
+	case "pipe":
+		return "|", true
+	}
+	if !strings.HasPrefix(option, "delim=") || len(option) == len("delim=") {
+		return "", false
+	}
+	delimiter := option[len("delim="):]
+	if unquoted, err := strconv.Unquote(`"` + delimiter + `"`); err == nil && unquoted != "" {
+		delimiter = unquoted
+	}
+	return delimiter, true
+}
+
+// DelimiterPolicy tells how elements of delimited lists containing the delimiter are handled
+type DelimiterPolicy uint8
+
+const (
+	// DelimiterKeep writes the elements as they are
+	DelimiterKeep DelimiterPolicy = iota
+	// DelimiterError fails encoding with ErrDelimiterInElement
+	DelimiterError
+	// DelimiterEscape percent-encodes the delimiter and '%' in elements, e.g. "a,b" => "a%2Cb"
+	DelimiterEscape
+)
+
+// ArrayFormat is the format of slices and arrays, see WithArrayFormat
+type ArrayFormat uint8
+
+const (
+	ArrayFormatRepeat  = ArrayFormat(arrayFormatRepeat)  // ids=1&ids=2
+	ArrayFormatBracket = ArrayFormat(arrayFormatBracket) // ids[]=1&ids[]=2
+	ArrayFormatComma   = ArrayFormat(arrayFormatComma)   // ids=1,2, see also the `space`, `pipe` and `delim=` tag options
+	ArrayFormatIndex   = ArrayFormat(arrayFormatIndex)   // ids[0]=1&ids[1]=2
+)
+
+// NestedFormat is the format of nested structs and maps, see WithNestedFormat
+type NestedFormat uint8
+
+const (
+	NestedFormatBracket = NestedFormat(nestedFormatBracket) // user[name]=son
+	NestedFormatDot     = NestedFormat(nestedFormatDot)     // user.name=son
+	NestedFormatColon   = NestedFormat(nestedFormatColon)   // user:name=son
+)
+
 type nestedFormat uint8
 
 const (
 	nestedFormatBracket nestedFormat = iota // user[from]
 	nestedFormatDot                         // user.from
+	nestedFormatColon                       // user:from
+	nestedFormatFlat                        // from, children are promoted to the parent scope
 )
 
 // other fields implement baseField
 type baseField struct {
 	name      string
 	omitEmpty bool
+	// rules are the validation tag options of struct fields
+	rules *fieldRules
+	// defaultValue is the value of the `default=` option, encoded instead of nil and zero values
+	defaultValue reflect.Value
+}
+
+func (baseField *baseField) setDefault(v reflect.Value) {
+	baseField.defaultValue = v
+}
+
+func (baseField *baseField) withDefault(v reflect.Value) reflect.Value {
+	if baseField.defaultValue.IsValid() && isNilOrZero(v) {
+		return baseField.defaultValue
+	}
+	return v
+}
+
+func (baseField *baseField) setRules(rules *fieldRules) {
+	baseField.rules = rules
+}
+
+func (baseField *baseField) validate(v reflect.Value, path string, invalid ValidationErrors) ValidationErrors {
+	if baseField.rules == nil {
+		return invalid
+	}
+	for _, rule := range baseField.rules.violated(v) {
+		invalid = append(invalid, ValidationError{Path: path, Key: baseField.name, Rule: rule})
+	}
+	return invalid
+}
+
+func (baseField *baseField) fieldName() string {
+	return baseField.name
 }
 
 // embedField represents for nested struct
 type embedField struct {
 	*baseField
 	cachedFields cachedFields
+	// flatten is set for embedded structs whose fields are promoted to the parent scope
+	flatten bool
 }
 
 func newEmbedField(preAlloc int, tagName []byte, tagOptions [][]byte) *embedField {
@@ -61,22 +212,95 @@ func newEmbedField(preAlloc int, tagName []byte, tagOptions [][]byte) *embedFiel
 func (embedField *embedField) formatFnc(v reflect.Value, result resultFunc) error {
 	for v.Kind() == reflect.Ptr {
 		if v.IsNil() {
-			if !embedField.omitEmpty {
+			if !embedField.omitEmpty && !embedField.flatten {
 				result(embedField.name, "")
 			}
 			return nil
 		}
 		v = v.Elem()
 	}
+	var invalid ValidationErrors
 	for i, cachedField := range embedField.cachedFields {
 		if cachedField == nil {
 			continue
 		}
-		err := cachedField.formatFnc(v.Field(i), result)
+		fieldVal := cachedField.withDefault(v.Field(i))
+		invalid = cachedField.validate(fieldVal, v.Type().Field(i).Name, invalid)
+		err := cachedField.formatFnc(fieldVal, result)
 		if err != nil {
-			return err
+			err = wrapEncodeError(err, v.Type().Field(i).Name, nil)
+			if invalid, err = collectInvalid(invalid, err); err != nil {
+				return err
+			}
 		}
 	}
+	return invalid.errOrNil()
+}
+
+// objectField joins the properties of a struct or map into a single delimited value,
+// e.g. "color=R,100,G,200" for the OpenAPI form style without explode
+type objectField struct {
+	*baseField
+	// cachedField is the unnamed struct or map field emitting the properties
+	cachedField cachedField
+	delimiter   string
+}
+
+func (e *encoder) newObjectField(typ reflect.Type, delimiter string, tagName []byte, tagOptions [][]byte) *objectField {
+	field := &objectField{
+		baseField: &baseField{
+			name: string(tagName),
+		},
+		delimiter: delimiter,
+	}
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagOmitEmpty {
+			field.omitEmpty = true
+		}
+	}
+	field.cachedField = e.newCacheFieldByType(typ, nil, tagOptions)
+	return field
+}
+
+func (objectField *objectField) formatFnc(v reflect.Value, result resultFunc) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !objectField.omitEmpty {
+				result(objectField.name, "")
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+	if objectField.cachedField == nil {
+		//data type is not supported
+		return nil
+	}
+	var str strings.Builder
+	count := 0
+	hasFile := false
+	err := objectField.cachedField.formatFnc(v, func(name string, val string, file ...*File) {
+		hasFile = hasFile || (len(file) > 0 && file[0] != nil)
+		if count > 0 {
+			str.WriteString(objectField.delimiter)
+		}
+		count++
+		str.WriteString(name)
+		str.WriteString(objectField.delimiter)
+		str.WriteString(val)
+	})
+	if err == nil && hasFile {
+		err = ErrFileInDelimitedValue
+	}
+	if err != nil {
+		return wrapEncodeError(err, "", func(string) string {
+			return objectField.name
+		})
+	}
+	if count == 0 && objectField.omitEmpty {
+		return nil
+	}
+	result(objectField.name, str.String())
 	return nil
 }
 
@@ -85,148 +309,180 @@ type listField struct {
 	*baseField
 	cachedField cachedField
 	arrayFormat listFormat
+	// nested is true if elements are structs, lists, maps or interfaces,
+	// their keys are scoped under the element key
+	nested bool
+	// delimiter joins the elements of the delimited format
+	delimiter       string
+	delimiterPolicy DelimiterPolicy
+	// namedField formats elements under the list name directly for the repeat and bracket formats,
+	// it is nil for elements emitting their own keys
+	namedField cachedField
 }
 
 func (listField *listField) formatFnc(field reflect.Value, result resultFunc) error {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
 	switch listField.arrayFormat {
 	case arrayFormatComma:
 		var str strings.Builder
+		count := 0
 		for i := 0; i < field.Len(); i++ {
-			elemVal := field.Index(i)
-			if _, ok := listField.cachedField.(*customField); ok {
-				elem := elemVal
-				for elem.Kind() == reflect.Ptr {
-					elem = elem.Elem()
-				}
-				if !elem.IsValid() {
-					continue
-				}
-			} else {
-				for elemVal.Kind() == reflect.Ptr {
-					elemVal = elemVal.Elem()
-				}
-				if !elemVal.IsValid() {
-					continue
-				}
+			elemVal, ok := listField.elem(field, i)
+			if !ok {
+				continue
 			}
-			err := listField.cachedField.formatFnc(elemVal, func(name string, val string) {
-				if i > 0 {
-					str.WriteByte(',')
+			conflict, hasFile := false, false
+			err := listField.cachedField.formatFnc(elemVal, func(name string, val string, file ...*File) {
+				hasFile = hasFile || (len(file) > 0 && file[0] != nil)
+				if count > 0 {
+					str.WriteString(listField.delimiter)
+				}
+				count++
+				switch listField.delimiterPolicy {
+				case DelimiterError:
+					conflict = conflict || strings.Contains(val, listField.delimiter)
+					str.WriteString(val)
+				case DelimiterEscape:
+					writeEscapedElem(&str, val, listField.delimiter)
+				default:
+					str.WriteString(val)
 				}
-				str.WriteString(val)
 			})
+			if err == nil && hasFile {
+				err = ErrFileInDelimitedValue
+			}
+			if err == nil && conflict {
+				err = ErrDelimiterInElement
+			}
 			if err != nil {
-				return err
+				return wrapEncodeError(err, indexPath(i), func(string) string {
+					return listField.name
+				})
 			}
 		}
-		returnStr := str.String()
-		if len(returnStr) > 0 && returnStr[0] == ',' {
-			returnStr = returnStr[1:]
-		}
-		result(listField.name, returnStr)
+		result(listField.name, str.String())
 	case arrayFormatRepeat, arrayFormatBracket:
+		var invalid ValidationErrors
 		for i := 0; i < field.Len(); i++ {
-			elemVal := field.Index(i)
-			if _, ok := listField.cachedField.(*customField); ok {
-				elem := elemVal
-				for elem.Kind() == reflect.Ptr {
-					elem = elem.Elem()
-				}
-				if !elem.IsValid() {
-					continue
-				}
-			} else {
-				for elemVal.Kind() == reflect.Ptr {
-					elemVal = elemVal.Elem()
-				}
-				if !elemVal.IsValid() {
-					continue
+			elemVal, ok := listField.elem(field, i)
+			if !ok {
+				continue
+			}
+			if listField.namedField != nil {
+				if err := listField.namedField.formatFnc(elemVal, result); err != nil {
+					return wrapEncodeError(err, indexPath(i), nil)
 				}
+				continue
 			}
-			err := listField.cachedField.formatFnc(elemVal, func(name string, val string) {
-				result(listField.name, val)
+			err := listField.cachedField.formatFnc(elemVal, func(name string, val string, file ...*File) {
+				result(joinKey(listField.name, name), val, file...)
 			})
 			if err != nil {
-				return err
+				err = wrapEncodeError(err, indexPath(i), func(name string) string {
+					return joinKey(listField.name, name)
+				})
+				if invalid, err = collectInvalid(invalid, err); err != nil {
+					return err
+				}
 			}
 		}
+		return invalid.errOrNil()
 	case arrayFormatIndex:
+		var invalid ValidationErrors
 		count := 0
 		for i := 0; i < field.Len(); i++ {
-			elemVal := field.Index(i)
-			if _, ok := listField.cachedField.(*customField); ok {
-				elem := elemVal
-				for elem.Kind() == reflect.Ptr {
-					elem = elem.Elem()
-				}
-				if !elem.IsValid() {
-					continue
-				}
-			} else {
-				for elemVal.Kind() == reflect.Ptr {
-					elemVal = elemVal.Elem()
-				}
-				if !elemVal.IsValid() {
-					continue
-				}
-			}
-			if v, ok := listField.cachedField.(*embedField); ok {
-				err := v.formatFnc(elemVal, func(name string, val string) {
-					var str strings.Builder
-					str.WriteString(listField.name)
-					str.WriteString(strconv.FormatInt(int64(i), 10))
-					str.WriteByte(']')
-					str.WriteByte('[')
-					str.WriteString(name)
-					str.WriteByte(']')
-					result(str.String(), val)
-					count++
-				})
-				if err != nil {
-					return err
-				}
+			elemVal, ok := listField.elem(field, i)
+			if !ok {
 				continue
 			}
-			err := listField.cachedField.formatFnc(elemVal, func(name string, val string) {
-				var key strings.Builder
-				key.WriteString(listField.name)
-				key.WriteString(strconv.FormatInt(int64(count), 10))
-				key.WriteString("]")
-				result(key.String(), val)
-				count++
+			// Nested elements keep their position, basic elements are numbered consecutively
+			index := count
+			if listField.nested {
+				index = i
+			}
+			count++
+			elemKey := listField.name + strconv.Itoa(index) + "]"
+			err := listField.cachedField.formatFnc(elemVal, func(name string, val string, file ...*File) {
+				result(joinKey(elemKey, name), val, file...)
 			})
 			if err != nil {
-				return err
+				err = wrapEncodeError(err, indexPath(i), func(name string) string {
+					return joinKey(elemKey, name)
+				})
+				if invalid, err = collectInvalid(invalid, err); err != nil {
+					return err
+				}
 			}
 		}
+		return invalid.errOrNil()
 	}
 	return nil
 }
 
-func (e *encoder) newListField(elemTyp reflect.Type, tagName []byte, tagOptions [][]byte) *listField {
-	removeIdx := -1
-	for i, tagOption := range tagOptions {
-		if string(tagOption) == tagOmitEmpty {
-			removeIdx = i
+// elem returns the i-th element to be formatted, ok is false if the element is nil
+func (listField *listField) elem(field reflect.Value, i int) (reflect.Value, bool) {
+	elemVal := field.Index(i)
+	switch listField.cachedField.(type) {
+	case *customField, *valuesField, *textField, *registeredField, *fileField:
+		// custom types may implement QueryParamEncoder on pointer receiver
+		elem := elemVal
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
 		}
+		return elemVal, elem.IsValid()
+	}
+	for elemVal.Kind() == reflect.Ptr {
+		elemVal = elemVal.Elem()
 	}
-	if removeIdx > -1 {
-		tagOptions = append(tagOptions[:removeIdx], tagOptions[removeIdx+1:]...)
+	return elemVal, elemVal.IsValid()
+}
+
+// isNestedField reports whether field produces keys of its own children
+func isNestedField(field cachedField) bool {
+	switch field.(type) {
+	case *embedField, *listField, *mapField, *interfaceField:
+		return true
+	default:
+		return false
 	}
+}
+
+// indexPath formats the field path segment of a slice/array element
+func indexPath(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
 
+func (e *encoder) newListField(elemTyp reflect.Type, tagName []byte, tagOptions [][]byte) *listField {
 	listField := &listField{
-		cachedField: newCacheFieldByType(elemTyp, nil, tagOptions),
+		arrayFormat:     e.e.arrayFormat,
+		delimiter:       ",",
+		delimiterPolicy: e.e.delimiterPolicy,
 	}
 
+	elemOptions := make([][]byte, 0, len(tagOptions))
 	for _, tagOption := range tagOptions {
-		switch string(tagOption) {
-		case "comma":
+		if delimiter, ok := delimiterFromOption(string(tagOption)); ok {
 			listField.arrayFormat = arrayFormatComma
+			listField.delimiter = delimiter
+			elemOptions = append(elemOptions, append([]byte(nil), tagOption...))
+			continue
+		}
+		switch string(tagOption) {
+		case tagOmitEmpty:
+			continue
+		case "repeat":
+			listField.arrayFormat = arrayFormatRepeat
 		case "bracket":
 			listField.arrayFormat = arrayFormatBracket
 		case "index":
 			listField.arrayFormat = arrayFormatIndex
 		}
+		elemOptions = append(elemOptions, append([]byte(nil), tagOption...))
 	}
 
 	switch listField.arrayFormat {
@@ -243,8 +499,14 @@ func (e *encoder) newListField(elemTyp reflect.Type, tagName []byte, tagOptions
 		name: string(tagName),
 	}
 
-	if field, ok := listField.cachedField.(*embedField); ok {
-		e.structCaching(&field.cachedFields, nestedFormatBracket, nil, reflect.Zero(elemTyp))
+	// Element field is created last, nested structs reuse the tag buffers
+	listField.cachedField = e.newCacheFieldByType(elemTyp, nil, elemOptions)
+
+	listField.nested = isNestedField(listField.cachedField)
+
+	if _, ok := listField.cachedField.(*valuesField); !ok && listField.cachedField != nil &&
+		!listField.nested && listField.arrayFormat <= arrayFormatBracket {
+		listField.namedField = e.newCacheFieldByType(elemTyp, []byte(listField.name), elemOptions)
 	}
 
 	return listField
@@ -254,51 +516,105 @@ type mapField struct {
 	*baseField
 	cachedKeyField   cachedField
 	cachedValueField cachedField
+	// sorted emits entries sorted by their encoded key instead of map iteration order
+	sorted bool
+	// notation scopes the keys under the map name
+	notation nestedFormat
+	// flat is set for maps whose entries are promoted to the parent scope, name is the parent scope
+	flat bool
 }
 
 func (mapField *mapField) formatFnc(field reflect.Value, result resultFunc) error {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	if mapField.sorted {
+		return mapField.formatSorted(field, result)
+	}
+	var invalid ValidationErrors
 	mapRange := field.MapRange()
-	fieldName := make([]byte, 0, 36)
-	fieldName = append(fieldName, mapField.name...)
-
 	for mapRange.Next() {
-		fieldName = fieldName[:len(mapField.name)]
-		err := mapField.cachedKeyField.formatFnc(mapRange.Key(), func(_ string, val string) {
-			fieldName = append(fieldName, '[')
-			fieldName = append(fieldName, val...)
-			fieldName = append(fieldName, ']')
-		})
+		fieldName, err := mapField.keyName(mapRange.Key())
 		if err != nil {
 			return err
 		}
-		err = mapField.cachedValueField.formatFnc(mapRange.Value(), func(_ string, val string) {
-			result(string(fieldName), val)
-		})
+		if err = mapField.formatValue(fieldName, mapRange.Key(), mapRange.Value(), result); err != nil {
+			if invalid, err = collectInvalid(invalid, err); err != nil {
+				return err
+			}
+		}
+	}
+	return invalid.errOrNil()
+}
+
+// formatSorted formats the entries sorted by their encoded key
+func (mapField *mapField) formatSorted(field reflect.Value, result resultFunc) error {
+	type entry struct {
+		name string
+		key  reflect.Value
+	}
+	entries := make([]entry, 0, field.Len())
+	mapRange := field.MapRange()
+	for mapRange.Next() {
+		fieldName, err := mapField.keyName(mapRange.Key())
 		if err != nil {
 			return err
 		}
+		entries = append(entries, entry{name: fieldName, key: mapRange.Key()})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	var invalid ValidationErrors
+	for _, entry := range entries {
+		err := mapField.formatValue(entry.name, entry.key, field.MapIndex(entry.key), result)
+		if err != nil {
+			if invalid, err = collectInvalid(invalid, err); err != nil {
+				return err
+			}
+		}
 	}
-	return nil
+	return invalid.errOrNil()
 }
 
-func newMapField(keyType reflect.Type, valueType reflect.Type, tagName []byte, tagOptions [][]byte) *mapField {
-	removeIdx := -1
-	for i, tagOption := range tagOptions {
-		if string(tagOption) == tagOmitEmpty {
-			removeIdx = i
-		}
+// keyName returns the name of a map entry, the encoded key scoped under the map name
+func (mapField *mapField) keyName(key reflect.Value) (string, error) {
+	var encodedKey string
+	err := mapField.cachedKeyField.formatFnc(key, func(_ string, val string, _ ...*File) {
+		encodedKey = val
+	})
+	if err != nil {
+		return "", wrapEncodeError(err, fmt.Sprintf("[%v]", key), func(string) string {
+			return mapField.name
+		})
 	}
-	if removeIdx > -1 {
-		tagOptions = append(tagOptions[:removeIdx], tagOptions[removeIdx+1:]...)
+	// keys of top-level maps are not scoped
+	return scopedKey(mapField.name, encodedKey, mapField.notation), nil
+}
+
+func (mapField *mapField) formatValue(fieldName string, key reflect.Value, value reflect.Value, result resultFunc) error {
+	err := mapField.cachedValueField.formatFnc(value, func(name string, val string, file ...*File) {
+		result(joinKeyWith(fieldName, name, mapField.notation), val, file...)
+	})
+	if err != nil {
+		return wrapEncodeError(err, fmt.Sprintf("[%v]", key), func(name string) string {
+			return joinKeyWith(fieldName, name, mapField.notation)
+		})
 	}
+	return nil
+}
 
-	if !keyType.Implements(encoderType) {
+func (e *encoder) newMapField(keyType reflect.Type, valueType reflect.Type, tagName []byte, tagOptions [][]byte) *mapField {
+	if !e.e.isCustomType(keyType) {
 		for keyType.Kind() == reflect.Ptr {
 			keyType = keyType.Elem()
 		}
 	}
 
-	if !valueType.Implements(encoderType) {
+	if !e.e.isCustomType(valueType) {
 		for valueType.Kind() == reflect.Ptr {
 			valueType = valueType.Elem()
 		}
@@ -308,9 +624,18 @@ func newMapField(keyType reflect.Type, valueType reflect.Type, tagName []byte, t
 		baseField: &baseField{
 			name: string(tagName),
 		},
-		cachedKeyField:   newCacheFieldByType(keyType, nil, nil),
-		cachedValueField: newCacheFieldByType(valueType, nil, nil),
+		sorted:   e.e.sortedMapKeys,
+		notation: e.e.notationOf(tagOptions),
+	}
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagSorted {
+			field.sorted = true
+		}
 	}
+	// Value field is created last, nested structs reuse the tag buffers
+	// Nested lists, maps and structs follow the layout options of the map field
+	field.cachedKeyField = e.newCacheFieldByType(keyType, nil, nil)
+	field.cachedValueField = e.newCacheFieldByType(valueType, nil, nestingOptions(valueType, tagOptions))
 	return field
 }
 
@@ -625,6 +950,8 @@ func newComplex128Field(tagName []byte, tagOptions [][]byte) *complex128Field {
 type timeField struct {
 	*baseField
 	timeFormat timeFormat
+	layout     string
+	location   *time.Location
 }
 
 func (timeField *timeField) formatFnc(v reflect.Value, result resultFunc) error {
@@ -641,31 +968,174 @@ func (timeField *timeField) formatFnc(v reflect.Value, result resultFunc) error
 	if t.IsZero() && timeField.omitEmpty {
 		return nil
 	}
+	if timeField.location != nil {
+		t = t.In(timeField.location)
+	}
 	switch timeField.timeFormat {
 	case timeFormatSecond:
 		result(timeField.name, strconv.FormatInt(t.Unix(), 10))
 	case timeFormatMillis:
 		result(timeField.name, strconv.FormatInt(t.UnixNano()/1000000, 10))
+	case timeFormatMicros:
+		result(timeField.name, strconv.FormatInt(t.UnixMicro(), 10))
+	case timeFormatNanos:
+		result(timeField.name, strconv.FormatInt(t.UnixNano(), 10))
+	case timeFormatFracSecond:
+		result(timeField.name, formatFracSecond(t))
+	case timeFormatLayout:
+		result(timeField.name, t.Format(timeField.layout))
 	default:
 		result(timeField.name, t.Format(time.RFC3339))
 	}
 	return nil
 }
 
-func newTimeField(tagName []byte, tagOptions [][]byte) *timeField {
+// formatFracSecond formats t as unix seconds with the fractional part trimmed of trailing zeros
+func formatFracSecond(t time.Time) string {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	sign := ""
+	if sec < 0 {
+		sign = "-"
+		if nsec > 0 {
+			sec, nsec = -(sec + 1), 1e9-nsec
+		} else {
+			sec = -sec
+		}
+	}
+	str := sign + strconv.FormatInt(sec, 10)
+	if nsec == 0 {
+		return str
+	}
+	frac := strconv.FormatInt(nsec+1e9, 10)[1:]
+	return str + "." + strings.TrimRight(frac, "0")
+}
+
+func (e *encoder) newTimeField(tagName []byte, tagOptions [][]byte) *timeField {
 	field := &timeField{
 		baseField: &baseField{
 			name: string(tagName),
 		},
+		timeFormat: e.e.timeFormat,
+		layout:     e.e.timeLayout,
+		location:   e.e.timeLocation,
 	}
 	for _, tagOption := range tagOptions {
-		switch string(tagOption) {
-		case tagOmitEmpty:
+		if string(tagOption) == tagOmitEmpty {
 			field.omitEmpty = true
-		case "second":
-			field.timeFormat = timeFormatSecond
-		case "millis":
-			field.timeFormat = timeFormatMillis
+			continue
+		}
+		if format, layout, ok := timeFormatFromOption(string(tagOption)); ok {
+			field.timeFormat = format
+			field.layout = layout
+		}
+	}
+	return field
+}
+
+type durationFormat uint8
+
+const (
+	durationFormatString durationFormat = iota // 1h30m0s
+	durationFormatSecond
+	durationFormatMillis
+	durationFormatNanos
+	durationFormatISO8601 // PT1H30M
+)
+
+func durationFormatFromOption(option string) (durationFormat, bool) {
+	switch option {
+	case "second":
+		return durationFormatSecond, true
+	case "millis":
+		return durationFormatMillis, true
+	case "nanos":
+		return durationFormatNanos, true
+	case "iso8601":
+		return durationFormatISO8601, true
+	default:
+		return durationFormatString, false
+	}
+}
+
+// Duration field
+type durationField struct {
+	*baseField
+	durationFormat durationFormat
+}
+
+func (durationField *durationField) formatFnc(v reflect.Value, result resultFunc) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !durationField.omitEmpty {
+				result(durationField.name, "")
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+	d := time.Duration(v.Int())
+	if d == 0 && durationField.omitEmpty {
+		return nil
+	}
+	switch durationField.durationFormat {
+	case durationFormatSecond:
+		result(durationField.name, strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+	case durationFormatMillis:
+		result(durationField.name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64))
+	case durationFormatNanos:
+		result(durationField.name, strconv.FormatInt(int64(d), 10))
+	case durationFormatISO8601:
+		result(durationField.name, formatISO8601Duration(d))
+	default:
+		result(durationField.name, d.String())
+	}
+	return nil
+}
+
+// formatISO8601Duration formats d in hours, minutes and seconds, e.g. PT1H30M
+func formatISO8601Duration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var str strings.Builder
+	u := uint64(d)
+	if d < 0 {
+		str.WriteByte('-')
+		u = -u
+	}
+	str.WriteString("PT")
+	if hours := u / uint64(time.Hour); hours > 0 {
+		str.WriteString(strconv.FormatUint(hours, 10))
+		str.WriteByte('H')
+	}
+	if minutes := u % uint64(time.Hour) / uint64(time.Minute); minutes > 0 {
+		str.WriteString(strconv.FormatUint(minutes, 10))
+		str.WriteByte('M')
+	}
+	if nanos := u % uint64(time.Minute); nanos > 0 {
+		str.WriteString(strconv.FormatUint(nanos/uint64(time.Second), 10))
+		if frac := nanos % uint64(time.Second); frac > 0 {
+			str.WriteByte('.')
+			str.WriteString(strings.TrimRight(strconv.FormatUint(frac+1e9, 10)[1:], "0"))
+		}
+		str.WriteByte('S')
+	}
+	return str.String()
+}
+
+func newDurationField(tagName []byte, tagOptions [][]byte) *durationField {
+	field := &durationField{
+		baseField: &baseField{
+			name: string(tagName),
+		},
+	}
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagOmitEmpty {
+			field.omitEmpty = true
+			continue
+		}
+		if format, ok := durationFormatFromOption(string(tagOption)); ok {
+			field.durationFormat = format
 		}
 	}
 	return field
@@ -708,7 +1178,7 @@ func (customField *customField) formatFnc(v reflect.Value, result resultFunc) er
 	}
 	str, err := valueInterface.(QueryParamEncoder).EncodeParam()
 	if err != nil {
-		return err
+		return EncodeError{Key: customField.name, Err: err}
 	}
 	result(customField.name, str)
 	return nil
@@ -734,18 +1204,242 @@ func newCustomField(typ reflect.Type, tagName []byte, tagOptions [][]byte) *cust
 	return field
 }
 
+// writeEscapedElem writes val percent-encoding '%' and the bytes of delimiter
+func writeEscapedElem(str *strings.Builder, val string, delimiter string) {
+	const upperHex = "0123456789ABCDEF"
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if c == '%' || strings.IndexByte(delimiter, c) >= 0 {
+			str.WriteByte('%')
+			str.WriteByte(upperHex[c>>4])
+			str.WriteByte(upperHex[c&15])
+			continue
+		}
+		str.WriteByte(c)
+	}
+}
+
+// QueryValuesEncoder is an interface implemented by any type to encode itself into several query params
+// key is the scoped name of the field, e.g. filter[bbox], values added to v are emitted in key order
+type QueryValuesEncoder interface {
+	EncodeValues(key string, v url.Values) error
+}
+
+type valuesField struct {
+	*baseField
+	isZeroer bool
+}
+
+func (valuesField *valuesField) formatFnc(v reflect.Value, result resultFunc) error {
+	elem := v
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if !elem.IsValid() {
+		if !valuesField.omitEmpty {
+			result(valuesField.name, "")
+		}
+		return nil
+	}
+	valueInterface := v.Interface()
+	if valuesField.isZeroer && valueInterface.(Zeroer).IsZero() {
+		if !valuesField.omitEmpty {
+			result(valuesField.name, "")
+		}
+		return nil
+	}
+	values := make(url.Values)
+	if err := valueInterface.(QueryValuesEncoder).EncodeValues(valuesField.name, values); err != nil {
+		return EncodeError{Key: valuesField.name, Err: err}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, val := range values[key] {
+			result(key, val)
+		}
+	}
+	return nil
+}
+
+func newValuesField(typ reflect.Type, tagName []byte, tagOptions [][]byte) *valuesField {
+	field := &valuesField{
+		baseField: &baseField{
+			name: string(tagName),
+		},
+		isZeroer: typ.Implements(zeroerType),
+	}
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagOmitEmpty {
+			field.omitEmpty = true
+		}
+	}
+	return field
+}
+
+// registeredField represents for types registered by WithCustomType
+type registeredField struct {
+	*baseField
+	typ reflect.Type
+	fnc func(reflect.Value) (string, error)
+}
+
+func (registeredField *registeredField) formatFnc(v reflect.Value, result resultFunc) error {
+	for v.Kind() == reflect.Ptr && v.Type() != registeredField.typ {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsZero() && registeredField.omitEmpty {
+		if !registeredField.omitEmpty {
+			result(registeredField.name, "")
+		}
+		return nil
+	}
+	str, err := registeredField.fnc(v)
+	if err != nil {
+		return EncodeError{Key: registeredField.name, Err: err}
+	}
+	result(registeredField.name, str)
+	return nil
+}
+
+func newRegisteredField(typ reflect.Type, fnc func(reflect.Value) (string, error), tagName []byte, tagOptions [][]byte) *registeredField {
+	field := &registeredField{
+		baseField: &baseField{
+			name: string(tagName),
+		},
+		typ: typ,
+		fnc: fnc,
+	}
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagOmitEmpty {
+			field.omitEmpty = true
+		}
+	}
+	return field
+}
+
+type textFormat uint8
+
+const (
+	textFormatMarshaler textFormat = iota // encoding.TextMarshaler
+	textFormatStringer                    // fmt.Stringer
+)
+
+// textField represents for types implementing encoding.TextMarshaler or fmt.Stringer
+type textField struct {
+	*baseField
+	isZeroer   bool
+	textFormat textFormat
+	// byPtr is set for types implementing the methods with pointer receivers
+	byPtr bool
+}
+
+func (textField *textField) formatFnc(v reflect.Value, result resultFunc) error {
+	elem := v
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if !elem.IsValid() {
+		if !textField.omitEmpty {
+			result(textField.name, "")
+		}
+		return nil
+	}
+	if textField.byPtr {
+		v = addressOf(v)
+	}
+	valueInterface := v.Interface()
+	if textField.isZeroer && valueInterface.(Zeroer).IsZero() {
+		if !textField.omitEmpty {
+			result(textField.name, "")
+		}
+		return nil
+	}
+	if textField.textFormat == textFormatStringer {
+		result(textField.name, valueInterface.(fmt.Stringer).String())
+		return nil
+	}
+	text, err := valueInterface.(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return EncodeError{Key: textField.name, Err: err}
+	}
+	result(textField.name, string(text))
+	return nil
+}
+
+func newTextField(typ reflect.Type, format textFormat, tagName []byte, tagOptions [][]byte) *textField {
+	field := &textField{
+		baseField: &baseField{
+			name: string(tagName),
+		},
+		textFormat: format,
+	}
+	method := textMarshalerType
+	if format == textFormatStringer {
+		method = stringerType
+	}
+	if !typ.Implements(method) {
+		field.byPtr = true
+		typ = reflect.PtrTo(typ)
+	}
+	field.isZeroer = typ.Implements(zeroerType)
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagOmitEmpty {
+			field.omitEmpty = true
+		}
+	}
+	return field
+}
+
+// addressOf returns a pointer to v, copying v if it is not addressable
+func addressOf(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr
+}
+
 type interfaceField struct {
 	*baseField
-	tagName    []byte
+	e          *Encoder
 	tagOptions [][]byte
 	fieldMap   map[reflect.Type]cachedField
+	mutex      sync.RWMutex
+}
+
+// fieldOf returns the cached field of a dynamic type, building it on first use
+// It returns nil if the data type is not supported
+func (interfaceField *interfaceField) fieldOf(typ reflect.Type) cachedField {
+	interfaceField.mutex.RLock()
+	field, ok := interfaceField.fieldMap[typ]
+	interfaceField.mutex.RUnlock()
+	if ok {
+		return field
+	}
+
+	enc := interfaceField.e.dataPool.Get().(*encoder)
+	field = enc.newCacheFieldByType(typ, nil, interfaceField.tagOptions)
+	interfaceField.e.dataPool.Put(enc)
+
+	interfaceField.mutex.Lock()
+	defer interfaceField.mutex.Unlock()
+	if cached, ok := interfaceField.fieldMap[typ]; ok {
+		return cached
+	}
+	interfaceField.fieldMap[typ] = field
+	return field
 }
 
 func (interfaceField *interfaceField) formatFnc(v reflect.Value, result resultFunc) error {
 
 	v = v.Elem()
 
-	if v.IsValid() && v.Type().Implements(encoderType) {
+	if v.IsValid() && interfaceField.e.isCustomType(v.Type()) {
 		elem := v
 		for elem.Kind() == reflect.Ptr {
 			elem = elem.Elem()
@@ -766,29 +1460,31 @@ func (interfaceField *interfaceField) formatFnc(v reflect.Value, result resultFu
 		}
 	}
 
-	if field := interfaceField.fieldMap[v.Type()]; field == nil {
-		interfaceField.fieldMap[v.Type()] = newCacheFieldByType(v.Type(), interfaceField.tagName, interfaceField.tagOptions)
-	}
-	if field := interfaceField.fieldMap[v.Type()]; field != nil {
-		err := field.formatFnc(v, result)
+	if field := interfaceField.fieldOf(v.Type()); field != nil {
+		// Dynamic fields are created unnamed, their keys are scoped under the interface field
+		err := field.formatFnc(v, func(name string, val string, file ...*File) {
+			result(joinKey(interfaceField.name, name), val, file...)
+		})
 		if err != nil {
-			return err
+			return wrapEncodeError(err, "", func(name string) string {
+				return joinKey(interfaceField.name, name)
+			})
 		}
 	}
 	return nil
 }
 
-func newInterfaceField(tagName []byte, tagOptions [][]byte) *interfaceField {
-	copiedTagName := make([]byte, len(tagName))
-	copy(copiedTagName, tagName)
+func (e *encoder) newInterfaceField(tagName []byte, tagOptions [][]byte) *interfaceField {
 	copiedTagOptions := make([][]byte, len(tagOptions))
-	copy(copiedTagOptions, tagOptions)
+	for i, tagOption := range tagOptions {
+		copiedTagOptions[i] = append([]byte(nil), tagOption...)
+	}
 
 	field := &interfaceField{
 		baseField: &baseField{
-			name: string(copiedTagName),
+			name: string(tagName),
 		},
-		tagName:    copiedTagName,
+		e:          e.e,
 		tagOptions: copiedTagOptions,
 		fieldMap:   make(map[reflect.Type]cachedField, 5),
 	}
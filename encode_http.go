@@ -0,0 +1,159 @@
+package qs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FormContentType is the content type of URL encoded form bodies
+const FormContentType = "application/x-www-form-urlencoded"
+
+// ConflictPolicy tells how the encoded params are merged with the params already in a URL
+type ConflictPolicy uint8
+
+const (
+	// ConflictReplace replaces the existing values of a key
+	ConflictReplace ConflictPolicy = iota
+	// ConflictAppend adds the encoded values after the existing values of a key
+	ConflictAppend
+	// ConflictError fails with a ConflictErr if a key is already in the URL
+	ConflictError
+)
+
+// SetQuery encodes v into the query of req.URL, merging it with the existing params (see AppendToURL)
+// v must be struct or map data type
+func (e *Encoder) SetQuery(req *http.Request, v interface{}) error {
+	return e.AppendToURL(req.URL, v, true)
+}
+
+// AppendToURL encodes v into the query of u
+// With merge the encoded params are appended in field order to the existing query, which is kept as is apart from
+// the keys removed by ConflictReplace (see WithConflictPolicy), otherwise the existing query is replaced.
+// u is left unchanged on error
+// v must be struct or map data type
+func (e *Encoder) AppendToURL(u *url.URL, v interface{}, merge bool) error {
+	if !merge || u.RawQuery == "" {
+		query, err := e.EncodeToString(v)
+		if err != nil {
+			return err
+		}
+		u.RawQuery = query
+		return nil
+	}
+
+	pairs, err := e.Pairs(v)
+	if err != nil {
+		return err
+	}
+	query, err := mergeQuery(u.RawQuery, pairs, e.conflictPolicy)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = query
+	return nil
+}
+
+// NewRequest creates a request to baseURL with v encoded into its query (see SetQuery)
+// v must be struct or map data type
+func (e *Encoder) NewRequest(ctx context.Context, method string, baseURL string, v interface{}) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, baseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.SetQuery(req, v); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// FormBody encodes v into an application/x-www-form-urlencoded body in struct field order,
+// the content type is returned for the Content-Type header
+// v must be struct or map data type
+func (e *Encoder) FormBody(v interface{}) (io.Reader, string, error) {
+	body, err := e.EncodeToString(v)
+	if err != nil {
+		return nil, "", err
+	}
+	return strings.NewReader(body), FormContentType, nil
+}
+
+// NewFormRequest creates a request to targetURL with v encoded as a form body (see FormBody)
+// v must be struct or map data type
+func (e *Encoder) NewFormRequest(ctx context.Context, method string, targetURL string, v interface{}) (*http.Request, error) {
+	body, contentType, err := e.FormBody(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// PostForm posts v as a form body to targetURL using client, http.DefaultClient is used if client is nil
+// v must be struct or map data type
+func (e *Encoder) PostForm(ctx context.Context, client *http.Client, targetURL string, v interface{}) (*http.Response, error) {
+	req, err := e.NewFormRequest(ctx, http.MethodPost, targetURL, v)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// mergeQuery appends pairs to the raw query following the conflict policy,
+// the params of the raw query are kept as is unless ConflictReplace removes their key
+func mergeQuery(rawQuery string, pairs Pairs, policy ConflictPolicy) (string, error) {
+	keys := make(map[string]struct{}, len(pairs))
+	for _, pair := range pairs {
+		keys[pair.Key] = struct{}{}
+	}
+
+	var query strings.Builder
+	query.Grow(len(rawQuery) + 1)
+	for rest := rawQuery; rest != ""; {
+		param := rest
+		if i := strings.IndexAny(rest, "&;"); i >= 0 {
+			param, rest = rest[:i+1], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		if key := rawQueryKey(strings.TrimRight(param, "&;")); key != "" {
+			if _, ok := keys[key]; ok {
+				switch policy {
+				case ConflictError:
+					return "", ConflictErr{Key: key}
+				case ConflictReplace:
+					continue
+				}
+			}
+		}
+		query.WriteString(param)
+	}
+
+	encoded := pairs.Encode()
+	if encoded == "" {
+		return query.String(), nil
+	}
+	if kept := query.String(); kept != "" && !strings.HasSuffix(kept, "&") && !strings.HasSuffix(kept, ";") {
+		query.WriteByte('&')
+	}
+	query.WriteString(encoded)
+	return query.String(), nil
+}
+
+// rawQueryKey returns the unescaped key of a raw query param, the raw key is returned if it can't be unescaped
+func rawQueryKey(param string) string {
+	key, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
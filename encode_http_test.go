@@ -0,0 +1,171 @@
+package qs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type httpQuery struct {
+	Page int      `qs:"page"`
+	Tags []string `qs:"tags"`
+}
+
+func TestAppendToURL(t *testing.T) {
+	t.Parallel()
+	query := httpQuery{Page: 2, Tags: []string{"a", "b"}}
+
+	u, _ := url.Parse("https://example.com/items?page=1&sort=name")
+	if err := NewEncoder().AppendToURL(u, query, false); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if u.RawQuery != "page=2&tags=a&tags=b" {
+		t.Errorf("expected %q, got %q", "page=2&tags=a&tags=b", u.RawQuery)
+		t.FailNow()
+	}
+
+	tests := []struct {
+		policy   ConflictPolicy
+		rawQuery string
+		expected string
+	}{
+		{
+			policy:   ConflictReplace,
+			rawQuery: "page=1&sort=name",
+			expected: "sort=name&page=2&tags=a&tags=b",
+		},
+		{
+			policy:   ConflictAppend,
+			rawQuery: "page=1&sort=name",
+			expected: "page=1&sort=name&page=2&tags=a&tags=b",
+		},
+		{
+			policy:   ConflictReplace,
+			rawQuery: "z=1;sig=abc%2F&page=1&y=2",
+			expected: "z=1;sig=abc%2F&y=2&page=2&tags=a&tags=b",
+		},
+		{
+			policy:   ConflictAppend,
+			rawQuery: "z=1;sig=abc%2F&",
+			expected: "z=1;sig=abc%2F&page=2&tags=a&tags=b",
+		},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse("https://example.com/items?" + test.rawQuery)
+		if err := NewEncoder(WithConflictPolicy(test.policy)).AppendToURL(u, query, true); err != nil {
+			t.Errorf("expected no error but got %v", err)
+			t.FailNow()
+		}
+		if u.RawQuery != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, u.RawQuery)
+			t.FailNow()
+		}
+	}
+
+	u, _ = url.Parse("https://example.com/items?page=1&sort=name")
+	err := NewEncoder(WithConflictPolicy(ConflictError)).AppendToURL(u, query, true)
+	var conflictErr ConflictErr
+	if !errors.As(err, &conflictErr) || conflictErr.Key != "page" {
+		t.Errorf("expected conflict of key page but got %v", err)
+		t.FailNow()
+	}
+	if u.RawQuery != "page=1&sort=name" {
+		t.Errorf("expected unchanged query, got %q", u.RawQuery)
+		t.FailNow()
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	req, err := encoder.NewRequest(context.Background(), http.MethodGet, "https://example.com/items?sort=name", httpQuery{Page: 2})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{"page": {"2"}, "sort": {"name"}}
+	if !reflect.DeepEqual(expected, req.URL.Query()) {
+		t.Errorf("expected %v, got %v", expected, req.URL.Query())
+		t.FailNow()
+	}
+
+	if _, err := encoder.NewRequest(context.Background(), http.MethodGet, "https://example.com", 1); err == nil {
+		t.Error("expected error of invalid input")
+		t.FailNow()
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com", nil)
+	if err := encoder.SetQuery(req, httpQuery{Page: 3, Tags: []string{"a"}}); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if req.URL.String() != "https://example.com?page=3&tags=a" {
+		t.Errorf("expected %q, got %q", "https://example.com?page=3&tags=a", req.URL.String())
+		t.FailNow()
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	body, contentType, err := encoder.FormBody(httpQuery{Page: 2, Tags: []string{"a b", "c"}})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	data, _ := io.ReadAll(body)
+	if string(data) != "page=2&tags=a+b&tags=c" || contentType != FormContentType {
+		t.Errorf("expected %q of %q, got %q of %q", "page=2&tags=a+b&tags=c", FormContentType, data, contentType)
+		t.FailNow()
+	}
+
+	if _, _, err := encoder.FormBody(1); err == nil {
+		t.Error("expected error of invalid input")
+		t.FailNow()
+	}
+}
+
+func TestPostForm(t *testing.T) {
+	t.Parallel()
+	var received httpQuery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != FormContentType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := NewDecoder().Decode(r.PostForm, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sent := httpQuery{Page: 2, Tags: []string{"a", "b"}}
+	resp, err := NewEncoder().PostForm(context.Background(), server.Client(), server.URL, sent)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(sent, received) {
+		t.Errorf("expected %v, got %v", sent, received)
+		t.FailNow()
+	}
+}
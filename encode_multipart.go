@@ -0,0 +1,216 @@
+package qs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var (
+	fileType   = reflect.TypeOf(File{})
+	osFileType = reflect.TypeOf(new(os.File))
+	readerType = reflect.TypeOf(new(io.Reader)).Elem()
+)
+
+// File is a file part of a multipart form
+// Fields declared as io.Reader or *os.File are written as file parts as well
+type File struct {
+	// Name is the file name, the base name of *os.File or the param key is used if empty
+	Name string
+	// ContentType is detected from the extension of Name if empty, defaulting to application/octet-stream
+	ContentType string
+	Reader      io.Reader
+}
+
+// isFileType reports whether typ is written as a file part of multipart forms,
+// other io.Reader types such as *bytes.Buffer keep their usual encoding
+func isFileType(typ reflect.Type) bool {
+	if typ == readerType || typ == osFileType {
+		return true
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ == fileType
+}
+
+// fileField represents File and io.Reader fields,
+// they are file parts of multipart forms and are encoded as their file name otherwise
+type fileField struct {
+	*baseField
+}
+
+func newFileField(tagName []byte, tagOptions [][]byte) *fileField {
+	field := &fileField{
+		baseField: &baseField{
+			name: string(tagName),
+		},
+	}
+	for _, tagOption := range tagOptions {
+		if string(tagOption) == tagOmitEmpty {
+			field.omitEmpty = true
+		}
+	}
+	return field
+}
+
+func (fileField *fileField) formatFnc(v reflect.Value, result resultFunc) error {
+	file, ok := fileOf(v)
+	if !ok {
+		if !fileField.omitEmpty {
+			result(fileField.name, "")
+		}
+		return nil
+	}
+	result(fileField.name, file.Name, file)
+	return nil
+}
+
+// fileOf returns the file held by v, ok is false for nil readers
+func fileOf(v reflect.Value) (*File, bool) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	if reader, ok := v.Interface().(io.Reader); ok {
+		file := &File{Reader: reader}
+		if named, ok := reader.(interface{ Name() string }); ok {
+			file.Name = filepath.Base(named.Name())
+		}
+		return file, true
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	file := v.Interface().(File)
+	if file.Reader == nil {
+		return nil, false
+	}
+	return &file, true
+}
+
+// WriteMultipart writes v into w as multipart/form-data parts in struct field order,
+// keys follow the same rules as Values. Nothing is written to w if v can't be encoded. w is not closed
+// v must be struct or map data type
+func (e *Encoder) WriteMultipart(w *multipart.Writer, v interface{}) error {
+	enc := e.dataPool.Get().(*encoder)
+	defer e.dataPool.Put(enc)
+
+	enc.collectParts = true
+	err := enc.encode(v, nil)
+	parts := enc.parts
+	enc.collectParts = false
+	defer func() {
+		// drop the references to the files before pooling the parts
+		for i := range parts {
+			parts[i] = formPart{}
+		}
+		if cap(parts) <= maxPooledKeys {
+			enc.parts = parts[:0]
+		} else {
+			enc.parts = nil
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if err := part.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultipartBody encodes v into a multipart/form-data body (see WriteMultipart),
+// the content type holding the boundary is returned for the Content-Type header
+// v must be struct or map data type
+func (e *Encoder) MultipartBody(v interface{}) (io.Reader, string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := e.WriteMultipart(w, v); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, w.FormDataContentType(), nil
+}
+
+// NewMultipartRequest creates a request to targetURL with v encoded as a multipart/form-data body (see MultipartBody)
+// v must be struct or map data type
+func (e *Encoder) NewMultipartRequest(ctx context.Context, method string, targetURL string, v interface{}) (*http.Request, error) {
+	body, contentType, err := e.MultipartBody(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// formPart is a param staged by WriteMultipart, file is nil for fields
+type formPart struct {
+	name string
+	val  string
+	file *File
+}
+
+// write writes the param into the multipart writer
+func (part formPart) write(w *multipart.Writer) error {
+	if part.file == nil {
+		return w.WriteField(part.name, part.val)
+	}
+	if err := writeFilePart(w, part.name, part.file); err != nil {
+		return EncodeError{Key: part.name, Err: err}
+	}
+	return nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// writeFilePart writes file as the part of the param name
+func writeFilePart(w *multipart.Writer, name string, file *File) error {
+	fileName := file.Name
+	if fileName == "" {
+		fileName = name
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(fileName))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		`form-data; name="`+quoteEscaper.Replace(name)+`"; filename="`+quoteEscaper.Replace(fileName)+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file.Reader)
+	return err
+}
@@ -0,0 +1,219 @@
+package qs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type multipartUser struct {
+	Name string `qs:"name"`
+}
+
+type multipartUpload struct {
+	Title       string        `qs:"title"`
+	Tags        []string      `qs:"tags,bracket"`
+	User        multipartUser `qs:"user"`
+	Avatar      File          `qs:"avatar"`
+	Doc         *os.File      `qs:"doc"`
+	Raw         io.Reader     `qs:"raw"`
+	Attachments []File        `qs:"attachments,bracket"`
+	Missing     io.Reader     `qs:"missing,omitempty"`
+}
+
+func newMultipartUpload(t *testing.T) multipartUpload {
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(path, []byte("report"), 0o600); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	doc, err := os.Open(path)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	t.Cleanup(func() { doc.Close() })
+
+	return multipartUpload{
+		Title:  "holiday",
+		Tags:   []string{"a", "b"},
+		User:   multipartUser{Name: "son"},
+		Avatar: File{Name: "photo.png", Reader: strings.NewReader("png")},
+		Doc:    doc,
+		Raw:    strings.NewReader("raw"),
+		Attachments: []File{
+			{Name: "a.bin", ContentType: "application/x-custom", Reader: strings.NewReader("a")},
+			{Name: "b.bin", Reader: strings.NewReader("b")},
+		},
+	}
+}
+
+func TestNewMultipartRequest(t *testing.T) {
+	t.Parallel()
+	req, err := NewEncoder().NewMultipartRequest(context.Background(), http.MethodPost, "https://example.com", newMultipartUpload(t))
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+
+	expected := url.Values{
+		"title":      {"holiday"},
+		"tags[]":     {"a", "b"},
+		"user[name]": {"son"},
+	}
+	if !reflect.DeepEqual(expected, url.Values(req.MultipartForm.Value)) {
+		t.Errorf("expected %v, got %v", expected, req.MultipartForm.Value)
+		t.FailNow()
+	}
+
+	files := []struct {
+		key         string
+		name        string
+		contentType string
+		content     string
+	}{
+		{key: "avatar", name: "photo.png", contentType: "image/png", content: "png"},
+		{key: "doc", name: "report.txt", contentType: "text/plain; charset=utf-8", content: "report"},
+		{key: "raw", name: "raw", contentType: "application/octet-stream", content: "raw"},
+		{key: "attachments[]", name: "a.bin", contentType: "application/x-custom", content: "a"},
+	}
+	for _, file := range files {
+		headers := req.MultipartForm.File[file.key]
+		if len(headers) == 0 {
+			t.Errorf("expected file part %s", file.key)
+			t.FailNow()
+		}
+		f, err := headers[0].Open()
+		if err != nil {
+			t.Errorf("expected no error but got %v", err)
+			t.FailNow()
+		}
+		content, _ := io.ReadAll(f)
+		f.Close()
+		if headers[0].Filename != file.name || headers[0].Header.Get("Content-Type") != file.contentType || string(content) != file.content {
+			t.Errorf("expected %s of %s with %q, got %s of %s with %q", file.name, file.contentType, file.content,
+				headers[0].Filename, headers[0].Header.Get("Content-Type"), content)
+			t.FailNow()
+		}
+	}
+	if len(req.MultipartForm.File["attachments[]"]) != 2 || len(req.MultipartForm.File["missing"]) != 0 {
+		t.Errorf("expected 2 attachments and no missing file, got %v", req.MultipartForm.File)
+		t.FailNow()
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestMultipartFileErrors(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	// Outside of multipart forms files are encoded as their file name
+	values, err := encoder.Values(struct {
+		Avatar File      `qs:"avatar"`
+		Raw    io.Reader `qs:"raw"`
+	}{Avatar: File{Name: "photo.png", Reader: strings.NewReader("png")}})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{"avatar": {"photo.png"}, "raw": {""}}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	_, _, err = encoder.MultipartBody(struct {
+		Raw io.Reader `qs:"raw"`
+	}{Raw: failingReader{}})
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Key != "raw" {
+		t.Errorf("expected encode error of key raw but got %v", err)
+		t.FailNow()
+	}
+
+	// Files can't be joined into a delimited value
+	_, err = encoder.Values(struct {
+		Files []File `qs:"files,comma"`
+	}{Files: []File{{Name: "a.txt", Reader: strings.NewReader("a")}}})
+	if !errors.As(err, &encodeErr) || encodeErr.Path != "Files[0]" || !errors.Is(err, ErrFileInDelimitedValue) {
+		t.Errorf("expected file error of path Files[0] but got %v", err)
+		t.FailNow()
+	}
+	type styledUpload struct {
+		Upload struct {
+			Doc File `qs:"doc"`
+		} `qs:"upload,style=form,explode=false"`
+	}
+	var upload styledUpload
+	upload.Upload.Doc = File{Name: "a.txt", Reader: strings.NewReader("a")}
+	_, _, err = encoder.MultipartBody(upload)
+	if !errors.As(err, &encodeErr) || encodeErr.Key != "upload" || !errors.Is(err, ErrFileInDelimitedValue) {
+		t.Errorf("expected file error of key upload but got %v", err)
+		t.FailNow()
+	}
+}
+
+// textReader is a reader which is not a file field, it is encoded as text
+type textReader struct {
+	*strings.Reader
+}
+
+func (r textReader) MarshalText() ([]byte, error) {
+	return []byte("text"), nil
+}
+
+func TestMultipartReaderTypes(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	query := struct {
+		Text   textReader      `qs:"text"`
+		Buffer *bytes.Buffer   `qs:"buffer,omitempty"`
+		Reader *strings.Reader `qs:"reader,omitempty"`
+	}{Text: textReader{strings.NewReader("content")}, Buffer: bytes.NewBufferString("content")}
+	values, err := encoder.Values(query)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{"text": {"text"}}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	body, contentType, err := encoder.MultipartBody(query)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	_, params, _ := mime.ParseMediaType(contentType)
+	form, err := multipart.NewReader(body, params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(map[string][]string{"text": {"text"}}, form.Value) || len(form.File) != 0 {
+		t.Errorf("expected text field only, got %v and %v", form.Value, form.File)
+		t.FailNow()
+	}
+}
@@ -1,7 +1,10 @@
 package qs
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"net/netip"
 	"net/url"
 	"reflect"
 	"strconv"
@@ -1371,6 +1374,33 @@ func TestEncoderIgnoreUnregisterType(t *testing.T) {
 		t.Errorf("expected empty values, got: %v", values)
 		t.FailNow()
 	}
+
+	// Unsupported fields of nested structs are skipped as well
+	type unsupported struct {
+		Name string              `qs:"name"`
+		Ch   []chan int          `qs:"chan"`
+		Fn   map[string]func()   `qs:"fn"`
+		Flat map[chan int]string `qs:"flat,flat"`
+	}
+	nested := struct {
+		Nested unsupported   `qs:"nested"`
+		Ptr    *unsupported  `qs:"ptr,dot"`
+		List   []unsupported `qs:"list,index"`
+	}{
+		Nested: unsupported{Name: "a", Ch: []chan int{make(chan int)}, Fn: map[string]func(){"f": func() {}}},
+		Ptr:    &unsupported{Name: "b", Flat: map[chan int]string{make(chan int): "c"}},
+		List:   []unsupported{{Name: "c", Ch: []chan int{make(chan int)}}},
+	}
+	values, err = encoder.Values(nested)
+	if err != nil {
+		t.Errorf("expected no error, got: %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{"nested[name]": {"a"}, "ptr.name": {"b"}, "list[0][name]": {"c"}}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got: %v", expected, values)
+		t.FailNow()
+	}
 }
 
 //------------------------------------------------
@@ -1454,3 +1484,1503 @@ func complex128ToStr(v complex128) string {
 func withTime(v time.Time) *time.Time {
 	return &v
 }
+
+var errSentinel = errors.New("sentinel error")
+
+type SentinelErrParam struct{}
+
+func (SentinelErrParam) EncodeParam() (string, error) {
+	return "", errSentinel
+}
+
+func TestEncodeErrorPath(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type User struct {
+		Name  string           `qs:"name"`
+		Since SentinelErrParam `qs:"since"`
+	}
+
+	type Filter struct {
+		Users []*User `qs:"users,index"`
+	}
+
+	s1 := struct {
+		Ignore string `qs:"-"`
+		Filter Filter `qs:"filter"`
+	}{
+		Filter: Filter{
+			Users: []*User{{Name: "a"}, nil, {Name: "c"}},
+		},
+	}
+	s2 := struct {
+		List []SentinelErrParam `qs:"list,comma"`
+	}{
+		List: []SentinelErrParam{{}},
+	}
+	s3 := struct {
+		Index []SentinelErrParam `qs:"index,index"`
+	}{
+		Index: []SentinelErrParam{{}},
+	}
+	s4 := struct {
+		Map map[string]SentinelErrParam `qs:"map"`
+	}{
+		Map: map[string]SentinelErrParam{"abc": {}},
+	}
+	s5 := struct {
+		Nested struct {
+			Param interface{} `qs:"param"`
+		} `qs:"nested,dot"`
+	}{}
+	s5.Nested.Param = SentinelErrParam{}
+
+	testCases := []struct {
+		name     string
+		input    interface{}
+		expected EncodeError
+	}{
+		{
+			name:     "nested index list",
+			input:    s1,
+			expected: EncodeError{Path: "Filter.Users[0].Since", Key: "filter[users][0][since]"},
+		},
+		{
+			name:     "comma list",
+			input:    s2,
+			expected: EncodeError{Path: "List[0]", Key: "list"},
+		},
+		{
+			name:     "index list",
+			input:    s3,
+			expected: EncodeError{Path: "Index[0]", Key: "index[0]"},
+		},
+		{
+			name:     "map value",
+			input:    s4,
+			expected: EncodeError{Path: "Map[abc]", Key: "map[abc]"},
+		},
+		{
+			name:     "interface",
+			input:    &s5,
+			expected: EncodeError{Path: "Nested.Param", Key: "nested.param"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := encoder.Values(testCase.input)
+			var encodeErr EncodeError
+			if !errors.As(err, &encodeErr) {
+				t.Errorf("expected EncodeError, got %v", err)
+				t.FailNow()
+			}
+			if encodeErr.Path != testCase.expected.Path || encodeErr.Key != testCase.expected.Key {
+				t.Errorf("expected path %q key %q, got path %q key %q",
+					testCase.expected.Path, testCase.expected.Key, encodeErr.Path, encodeErr.Key)
+				t.FailNow()
+			}
+			if !errors.Is(err, errSentinel) {
+				t.Errorf("expected error to wrap %v, got %v", errSentinel, err)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestEncodeTopLevelMap(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type User struct {
+		Name   string `qs:"name"`
+		Active bool   `qs:"active,omitempty"`
+		Geo    struct {
+			Lat string `qs:"lat"`
+		} `qs:"geo"`
+	}
+
+	user := User{Name: "son"}
+	user.Geo.Lat = "10.5"
+
+	m := map[string]interface{}{
+		"limit":  20,
+		"status": withStr("open"),
+		"nil":    nil,
+		"from":   time.Unix(600, 0).UTC(),
+		"filter": map[string]interface{}{
+			"status": "closed",
+			"range": map[string]int{
+				"min": 1,
+			},
+		},
+		"user": user,
+		"ts":   Timestamp{time.Unix(0, 0).UTC()},
+	}
+
+	expected := url.Values{
+		"limit":              []string{"20"},
+		"status":             []string{"open"},
+		"nil":                []string{""},
+		"from":               []string{"1970-01-01T00:10:00Z"},
+		"filter[status]":     []string{"closed"},
+		"filter[range][min]": []string{"1"},
+		"user[name]":         []string{"son"},
+		"user[geo][lat]":     []string{"10.5"},
+		"ts":                 []string{"1970-01-01T00:00:00Z"},
+	}
+
+	values, err := encoder.Values(m)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	values = url.Values{}
+	err = encoder.Encode(&m, values)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	values, err = encoder.Values(map[int]bool{1: true})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(url.Values{"1": []string{"true"}}, values) {
+		t.Errorf("expected %v, got %v", url.Values{"1": []string{"true"}}, values)
+		t.FailNow()
+	}
+
+	_, err = encoder.Values(map[string]interface{}{
+		"nested": map[string]interface{}{"param": SentinelErrParam{}},
+	})
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) {
+		t.Errorf("expected EncodeError, got %v", err)
+		t.FailNow()
+	}
+	if encodeErr.Path != "[nested][param]" || encodeErr.Key != "nested[param]" {
+		t.Errorf("unexpected path %q and key %q", encodeErr.Path, encodeErr.Key)
+		t.FailNow()
+	}
+}
+
+func TestEncodeMultiLevelNesting(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type Geo struct {
+		Lat string `qs:"lat"`
+	}
+
+	type Item struct {
+		Name string   `qs:"name"`
+		Tags []string `qs:"tags,index"`
+		Geo  *Geo     `qs:"geo,omitempty"`
+	}
+
+	s := struct {
+		Items       []Item                  `qs:"items,index"`
+		BracketList []Item                  `qs:"bracket,bracket"`
+		Grid        [][]int                 `qs:"grid,index"`
+		RepeatGrid  [][2]int                `qs:"repeat_grid"`
+		MapOfList   map[string][]int        `qs:"map_of_list,index"`
+		MapOfStruct map[string]*Geo         `qs:"map_of_struct"`
+		ListOfMap   []map[string]int        `qs:"list_of_map,index"`
+		MapOfMap    map[string]map[int]bool `qs:"map_of_map"`
+		Interfaces  []interface{}           `qs:"interfaces,index"`
+		NilGrid     *[][]int                `qs:"nil_grid,index"`
+		Unsupported [][]chan int            `qs:"unsupported,index"`
+	}{
+		Items: []Item{
+			{Name: "a", Tags: []string{"x", "y"}, Geo: &Geo{Lat: "1.5"}},
+			{Name: "b"},
+		},
+		BracketList: []Item{{Name: "c"}},
+		Grid:        [][]int{{1, 2}, nil, {3}},
+		RepeatGrid:  [][2]int{{4, 5}},
+		MapOfList:   map[string][]int{"a": {6, 7}},
+		MapOfStruct: map[string]*Geo{"hcm": {Lat: "10.5"}, "nil": nil},
+		ListOfMap:   []map[string]int{{"k": 8}},
+		MapOfMap:    map[string]map[int]bool{"m": {1: true}},
+		Interfaces:  []interface{}{"str", map[string]int{"k": 9}, Geo{Lat: "2.5"}},
+		Unsupported: [][]chan int{{make(chan int)}},
+	}
+
+	values, err := encoder.Values(&s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+
+	expected := url.Values{
+		"items[0][name]":          []string{"a"},
+		"items[0][tags][0]":       []string{"x"},
+		"items[0][tags][1]":       []string{"y"},
+		"items[0][geo][lat]":      []string{"1.5"},
+		"items[1][name]":          []string{"b"},
+		"bracket[][name]":         []string{"c"},
+		"grid[0][0]":              []string{"1"},
+		"grid[0][1]":              []string{"2"},
+		"grid[2][0]":              []string{"3"},
+		"repeat_grid":             []string{"4", "5"},
+		"map_of_list[a][0]":       []string{"6"},
+		"map_of_list[a][1]":       []string{"7"},
+		"map_of_struct[hcm][lat]": []string{"10.5"},
+		"map_of_struct[nil]":      []string{""},
+		"list_of_map[0][k]":       []string{"8"},
+		"map_of_map[m][1]":        []string{"true"},
+		"interfaces[0]":           []string{"str"},
+		"interfaces[1][k]":        []string{"9"},
+		"interfaces[2][lat]":      []string{"2.5"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	tm := time.Unix(1580601600, 123456789).UTC()
+	before := time.Unix(-2, 500000000).UTC()
+
+	times := struct {
+		Layout      time.Time   `qs:"layout,layout=2006-01-02 15:04"`
+		Date        time.Time   `qs:"date,date"`
+		Rfc3339Nano time.Time   `qs:"rfc3339nano,rfc3339nano"`
+		Rfc1123     time.Time   `qs:"rfc1123,rfc1123"`
+		Micros      time.Time   `qs:"micros,micros"`
+		Nanos       time.Time   `qs:"nanos,nanos"`
+		FracSecond  time.Time   `qs:"frac,fracsecond"`
+		Before      time.Time   `qs:"before,fracsecond"`
+		DateList    []time.Time `qs:"date_list,date,comma"`
+		Omit        time.Time   `qs:"omit,date,omitempty"`
+	}{
+		Layout:      tm,
+		Date:        tm,
+		Rfc3339Nano: tm,
+		Rfc1123:     tm,
+		Micros:      tm,
+		Nanos:       tm,
+		FracSecond:  tm,
+		Before:      before,
+		DateList:    []time.Time{tm, tm.AddDate(0, 0, 1)},
+	}
+	values, err := encoder.Values(times)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"layout":      []string{"2020-02-02 00:00"},
+		"date":        []string{"2020-02-02"},
+		"rfc3339nano": []string{"2020-02-02T00:00:00.123456789Z"},
+		"rfc1123":     []string{"Sun, 02 Feb 2020 00:00:00 UTC"},
+		"micros":      []string{"1580601600123456"},
+		"nanos":       []string{"1580601600123456789"},
+		"frac":        []string{"1580601600.123456789"},
+		"before":      []string{"-1.5"},
+		"date_list":   []string{"2020-02-02,2020-02-03"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+func TestWithTimeLayout(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+7", 7*60*60)
+	tm := time.Date(2020, 2, 2, 6, 30, 0, 0, loc)
+
+	times := struct {
+		Default time.Time  `qs:"default"`
+		Ptr     *time.Time `qs:"ptr"`
+		Second  time.Time  `qs:"second,second"`
+	}{
+		Default: tm,
+		Ptr:     &tm,
+		Second:  tm,
+	}
+
+	testCases := []struct {
+		name     string
+		options  []EncoderOption
+		expected url.Values
+	}{
+		{
+			name:    "layout",
+			options: []EncoderOption{WithTimeLayout("2006-01-02T15:04")},
+			expected: url.Values{
+				"default": []string{"2020-02-02T06:30"},
+				"ptr":     []string{"2020-02-02T06:30"},
+				"second":  []string{"1580599800"},
+			},
+		},
+		{
+			name:    "named layout with location",
+			options: []EncoderOption{WithTimeLayout("rfc3339"), WithTimeLocation(time.UTC)},
+			expected: url.Values{
+				"default": []string{"2020-02-01T23:30:00Z"},
+				"ptr":     []string{"2020-02-01T23:30:00Z"},
+				"second":  []string{"1580599800"},
+			},
+		},
+		{
+			name:    "millis",
+			options: []EncoderOption{WithTimeLayout("millis")},
+			expected: url.Values{
+				"default": []string{"1580599800000"},
+				"ptr":     []string{"1580599800000"},
+				"second":  []string{"1580599800"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			encoder := NewEncoder(testCase.options...)
+			values, err := encoder.Values(times)
+			if err != nil {
+				t.Errorf("expected no error but got %v", err)
+				t.FailNow()
+			}
+			if !reflect.DeepEqual(testCase.expected, values) {
+				t.Errorf("expected %v, got %v", testCase.expected, values)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestDurationFormat(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	d := time.Hour + 30*time.Minute + 1500*time.Millisecond
+
+	durations := struct {
+		Default   time.Duration   `qs:"default"`
+		Second    time.Duration   `qs:"second,second"`
+		Millis    time.Duration   `qs:"millis,millis"`
+		Nanos     time.Duration   `qs:"nanos,nanos"`
+		ISO8601   time.Duration   `qs:"iso8601,iso8601"`
+		Negative  time.Duration   `qs:"negative,iso8601"`
+		Zero      time.Duration   `qs:"zero,iso8601"`
+		Omit      time.Duration   `qs:"omit,omitempty"`
+		Ptr       *time.Duration  `qs:"ptr"`
+		NilPtr    *time.Duration  `qs:"nil_ptr"`
+		List      []time.Duration `qs:"list,second,comma"`
+		Interface interface{}     `qs:"interface"`
+	}{
+		Default:   d,
+		Second:    d,
+		Millis:    d,
+		Nanos:     d,
+		ISO8601:   d,
+		Negative:  -2 * time.Hour,
+		Ptr:       &d,
+		List:      []time.Duration{time.Second, 2 * time.Minute},
+		Interface: time.Minute,
+	}
+	values, err := encoder.Values(durations)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"default":   []string{"1h30m1.5s"},
+		"second":    []string{"5401.5"},
+		"millis":    []string{"5401500"},
+		"nanos":     []string{"5401500000000"},
+		"iso8601":   []string{"PT1H30M1.5S"},
+		"negative":  []string{"-PT2H"},
+		"zero":      []string{"PT0S"},
+		"ptr":       []string{"1h30m1.5s"},
+		"nil_ptr":   []string{""},
+		"list":      []string{"1,120"},
+		"interface": []string{"1m0s"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+type textLevel int
+
+func (l textLevel) MarshalText() ([]byte, error) {
+	switch l {
+	case 0:
+		return []byte("low"), nil
+	case 1:
+		return []byte("high"), nil
+	}
+	return nil, errors.New("unknown level")
+}
+
+type textPoint struct {
+	X, Y int
+}
+
+func (p *textPoint) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d:%d", p.X, p.Y)), nil
+}
+
+type stringerColor int
+
+func (c stringerColor) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+type textAndEncoder int
+
+func (textAndEncoder) MarshalText() ([]byte, error) {
+	return []byte("text"), nil
+}
+
+func (textAndEncoder) EncodeParam() (string, error) {
+	return "param", nil
+}
+
+func TestEncodeTextMarshaler(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	addr := netip.MustParseAddr("10.0.0.1")
+	s := struct {
+		Addr     netip.Addr           `qs:"addr"`
+		AddrPtr  *netip.Addr          `qs:"addr_ptr"`
+		Level    textLevel            `qs:"level"`
+		Point    *textPoint           `qs:"point"`
+		NilPoint *textPoint           `qs:"nil_point"`
+		Points   []*textPoint         `qs:"points,comma"`
+		Levels   map[string]textLevel `qs:"levels"`
+		Keys     map[textLevel]int    `qs:"keys"`
+		Both     textAndEncoder       `qs:"both"`
+		Time     time.Time            `qs:"time,second"`
+		Color    stringerColor        `qs:"color"`
+		Omit     *textPoint           `qs:"omit,omitempty"`
+		Iface    interface{}          `qs:"iface"`
+	}{
+		Addr:    addr,
+		AddrPtr: &addr,
+		Level:   1,
+		Point:   &textPoint{X: 1, Y: 2},
+		Points:  []*textPoint{{X: 3, Y: 4}, {X: 5, Y: 6}},
+		Levels:  map[string]textLevel{"a": 0},
+		Keys:    map[textLevel]int{1: 7},
+		Time:    time.Unix(10, 0),
+		Color:   1,
+		Iface:   textLevel(0),
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"addr":       []string{"10.0.0.1"},
+		"addr_ptr":   []string{"10.0.0.1"},
+		"level":      []string{"high"},
+		"point":      []string{"1:2"},
+		"nil_point":  []string{""},
+		"points":     []string{"3:4,5:6"},
+		"levels[a]":  []string{"low"},
+		"keys[high]": []string{"7"},
+		"both":       []string{"param"},
+		"time":       []string{"10"},
+		"color":      []string{"1"},
+		"iface":      []string{"low"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	_, err = encoder.Values(struct {
+		Level textLevel `qs:"level"`
+	}{Level: 2})
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Path != "Level" || encodeErr.Key != "level" {
+		t.Errorf("expected EncodeError at level, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestEncodeStringer(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder(WithStringer())
+
+	s := struct {
+		Color  stringerColor   `qs:"color"`
+		Colors []stringerColor `qs:"colors"`
+		Level  textLevel       `qs:"level"`
+		Dur    time.Duration   `qs:"dur,second"`
+	}{
+		Color:  1,
+		Colors: []stringerColor{0, 1},
+		Level:  0,
+		Dur:    time.Minute,
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"color":  []string{"green"},
+		"colors": []string{"red", "green"},
+		"level":  []string{"low"},
+		"dur":    []string{"60"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+type thirdPartyID [2]byte
+
+func TestWithCustomType(t *testing.T) {
+	t.Parallel()
+
+	encodeID := func(v reflect.Value) (string, error) {
+		id := v.Interface().(thirdPartyID)
+		return fmt.Sprintf("%x", id[:]), nil
+	}
+	encodeLevel := func(v reflect.Value) (string, error) {
+		return "level-" + strconv.Itoa(int(v.Int())), nil
+	}
+	errFailed := errors.New("failed")
+	encodeFloat := func(v reflect.Value) (string, error) {
+		return "", errFailed
+	}
+	encoder := NewEncoder(
+		WithCustomType(thirdPartyID{}, encodeID),
+		WithCustomType(reflect.TypeOf(textLevel(0)), encodeLevel),
+	)
+
+	id := thirdPartyID{0xab, 0xcd}
+	s := struct {
+		ID     thirdPartyID            `qs:"id"`
+		IDPtr  *thirdPartyID           `qs:"id_ptr"`
+		NilID  *thirdPartyID           `qs:"nil_id"`
+		OmitID thirdPartyID            `qs:"omit_id,omitempty"`
+		IDs    []*thirdPartyID         `qs:"ids,comma"`
+		IDMap  map[string]thirdPartyID `qs:"id_map"`
+		Level  textLevel               `qs:"level"`
+		Iface  interface{}             `qs:"iface"`
+	}{
+		ID:    id,
+		IDPtr: &id,
+		IDs:   []*thirdPartyID{&id, {0x01, 0x02}},
+		IDMap: map[string]thirdPartyID{"a": id},
+		Level: 3,
+		Iface: id,
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"id":        []string{"abcd"},
+		"id_ptr":    []string{"abcd"},
+		"nil_id":    []string{""},
+		"ids":       []string{"abcd,0102"},
+		"id_map[a]": []string{"abcd"},
+		"level":     []string{"level-3"},
+		"iface":     []string{"abcd"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	encoder = NewEncoder(WithCustomType(float64(0), encodeFloat))
+	_, err = encoder.Values(struct {
+		Price float64 `qs:"price"`
+	}{Price: 1.5})
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Key != "price" || !errors.Is(err, errFailed) {
+		t.Errorf("expected EncodeError at price, got %v", err)
+		t.FailNow()
+	}
+}
+
+type boundingBox struct {
+	MinLat, MaxLat float64
+}
+
+func (b boundingBox) EncodeValues(key string, v url.Values) error {
+	if b.MinLat > b.MaxLat {
+		return errors.New("invalid bounding box")
+	}
+	v.Set(key+"[min_lat]", strconv.FormatFloat(b.MinLat, 'f', -1, 64))
+	v.Set(key+"[max_lat]", strconv.FormatFloat(b.MaxLat, 'f', -1, 64))
+	return nil
+}
+
+type dateRange struct {
+	From, To string
+}
+
+func (r *dateRange) EncodeValues(_ string, v url.Values) error {
+	v.Set("from", r.From)
+	v.Set("to", r.To)
+	return nil
+}
+
+func TestEncodeValuesEncoder(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type filter struct {
+		BBox boundingBox `qs:"bbox"`
+	}
+	s := struct {
+		BBox   boundingBox            `qs:"bbox"`
+		Range  *dateRange             `qs:"range"`
+		NilBox *boundingBox           `qs:"nil_box,omitempty"`
+		Filter filter                 `qs:"filter"`
+		Boxes  []boundingBox          `qs:"boxes,index"`
+		BoxMap map[string]boundingBox `qs:"box_map"`
+		Iface  interface{}            `qs:"iface"`
+	}{
+		BBox:   boundingBox{MinLat: 1, MaxLat: 2},
+		Range:  &dateRange{From: "2020", To: "2021"},
+		Filter: filter{BBox: boundingBox{MinLat: 3, MaxLat: 4}},
+		Boxes:  []boundingBox{{MinLat: 5, MaxLat: 6}},
+		BoxMap: map[string]boundingBox{"a": {MinLat: 7, MaxLat: 8}},
+		Iface:  boundingBox{MinLat: 9, MaxLat: 10},
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"bbox[min_lat]":         []string{"1"},
+		"bbox[max_lat]":         []string{"2"},
+		"from":                  []string{"2020"},
+		"to":                    []string{"2021"},
+		"filter[bbox][min_lat]": []string{"3"},
+		"filter[bbox][max_lat]": []string{"4"},
+		"boxes[0][min_lat]":     []string{"5"},
+		"boxes[0][max_lat]":     []string{"6"},
+		"box_map[a][min_lat]":   []string{"7"},
+		"box_map[a][max_lat]":   []string{"8"},
+		"iface[min_lat]":        []string{"9"},
+		"iface[max_lat]":        []string{"10"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	_, err = encoder.Values(struct {
+		BBox boundingBox `qs:"bbox"`
+	}{BBox: boundingBox{MinLat: 2, MaxLat: 1}})
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Path != "BBox" || encodeErr.Key != "bbox" {
+		t.Errorf("expected EncodeError at bbox, got %v", err)
+		t.FailNow()
+	}
+}
+
+type Pagination struct {
+	Page  int `qs:"page"`
+	Limit int `qs:"limit"`
+}
+
+type Sorting struct {
+	Sort  string `qs:"sort"`
+	Limit int    `qs:"limit"`
+}
+
+type sortingOrder struct {
+	Order string `qs:"order"`
+}
+
+func TestEncodeEmbeddedStruct(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type filter struct {
+		*Pagination
+		Status string `qs:"status"`
+	}
+	s := struct {
+		Pagination
+		*Sorting
+		sortingOrder
+		Named  Pagination `qs:"named"`
+		Filter filter     `qs:"filter"`
+		Page   string     `qs:"page"`
+	}{
+		Pagination:   Pagination{Page: 1, Limit: 10},
+		Sorting:      &Sorting{Sort: "name", Limit: 20},
+		sortingOrder: sortingOrder{Order: "asc"},
+		Named:        Pagination{Page: 2, Limit: 30},
+		Filter:       filter{Pagination: &Pagination{Page: 3, Limit: 40}, Status: "open"},
+		Page:         "first",
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	// page is shadowed by the outer field, limit is ambiguous between Pagination and Sorting
+	expected := url.Values{
+		"page":           []string{"first"},
+		"sort":           []string{"name"},
+		"order":          []string{"asc"},
+		"named[page]":    []string{"2"},
+		"named[limit]":   []string{"30"},
+		"filter[page]":   []string{"3"},
+		"filter[limit]":  []string{"40"},
+		"filter[status]": []string{"open"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	// nil embedded pointers are skipped, a tagged field wins a tie
+	type untaggedSort struct {
+		Sort string
+	}
+	type taggedSort struct {
+		By string `qs:"Sort"`
+	}
+	tagged := struct {
+		*Pagination
+		untaggedSort
+		taggedSort
+	}{
+		untaggedSort: untaggedSort{Sort: "untagged"},
+		taggedSort:   taggedSort{By: "tagged"},
+	}
+	values, err = encoder.Values(tagged)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected = url.Values{
+		"Sort": []string{"tagged"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	s := struct {
+		Name   string            `qs:"name"`
+		Tags   []string          `qs:"tags"`
+		Filter map[string]string `qs:"filter"`
+		Empty  []int             `qs:"empty"`
+	}{
+		Name:   "a b&c",
+		Tags:   []string{"x/y", "z"},
+		Filter: map[string]string{"status": "open"},
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	// Run twice to encode with the pooled buffers
+	for i := 0; i < 2; i++ {
+		query, err := encoder.AppendQuery(nil, s)
+		if err != nil {
+			t.Errorf("expected no error but got %v", err)
+			t.FailNow()
+		}
+		if string(query) != values.Encode() {
+			t.Errorf("expected %s, got %s", values.Encode(), query)
+			t.FailNow()
+		}
+	}
+
+	for dst, expected := range map[string]string{
+		"/path?":       "/path?name=a",
+		"/path?page=1": "/path?page=1&name=a",
+		"page=1&":      "page=1&name=a",
+	} {
+		query, err := encoder.AppendQuery([]byte(dst), map[string]string{"name": "a"})
+		if err != nil {
+			t.Errorf("expected no error but got %v", err)
+			t.FailNow()
+		}
+		if string(query) != expected {
+			t.Errorf("expected %s, got %s", expected, query)
+			t.FailNow()
+		}
+	}
+
+	query, err := encoder.AppendQuery([]byte("page=1"), 1)
+	if _, ok := err.(InvalidInputErr); !ok || string(query) != "page=1" {
+		t.Errorf("expected InvalidInputErr and unchanged dst, got %v, %s", err, query)
+		t.FailNow()
+	}
+}
+
+func TestAppendQueryAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops pooled encoders randomly with the race detector")
+	}
+	encoder := NewEncoder()
+
+	s := &struct {
+		Name  string   `qs:"name"`
+		Count int      `qs:"count"`
+		Ok    bool     `qs:"ok"`
+		Tags  []string `qs:"tags"`
+	}{
+		Name:  "name",
+		Count: 12,
+		Ok:    true,
+		Tags:  []string{"a", "b"},
+	}
+	dst := make([]byte, 0, 128)
+	if _, err := encoder.AppendQuery(dst, s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, _ = encoder.AppendQuery(dst[:0], s)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocation, got %v", allocs)
+		t.FailNow()
+	}
+}
+
+func TestEncodeToString(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		Name string `qs:"name"`
+		Age  int    `qs:"age"`
+	}
+	s := struct {
+		Zeta  string   `qs:"zeta"`
+		User  user     `qs:"user"`
+		Tags  []string `qs:"tags,bracket"`
+		Items []user   `qs:"items,index"`
+		Alpha string   `qs:"alpha,omitempty"`
+		Space string   `qs:"space"`
+	}{
+		Zeta:  "z",
+		User:  user{Name: "son", Age: 30},
+		Tags:  []string{"b", "a"},
+		Items: []user{{Name: "x", Age: 1}},
+		Space: "a b&c",
+	}
+
+	encoder := NewEncoder()
+	query, err := encoder.EncodeToString(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := "zeta=z&user%5Bname%5D=son&user%5Bage%5D=30&tags%5B%5D=b&tags%5B%5D=a" +
+		"&items%5B0%5D%5Bname%5D=x&items%5B0%5D%5Bage%5D=1&space=a+b%26c"
+	if query != expected {
+		t.Errorf("expected %s, got %s", expected, query)
+		t.FailNow()
+	}
+
+	buf, err := encoder.AppendEncoded([]byte("/path?"), struct {
+		Name string `qs:"name"`
+	}{Name: "son"})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if string(buf) != "/path?name=son" {
+		t.Errorf("expected /path?name=son, got %s", buf)
+		t.FailNow()
+	}
+
+	sortedEncoder := NewEncoder(WithSortedOutput())
+	values, err := sortedEncoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	query, err = sortedEncoder.EncodeToString(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if query != values.Encode() {
+		t.Errorf("expected %s, got %s", values.Encode(), query)
+		t.FailNow()
+	}
+
+	_, err = encoder.EncodeToString(struct {
+		BBox boundingBox `qs:"bbox"`
+	}{BBox: boundingBox{MinLat: 2, MaxLat: 1}})
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) {
+		t.Errorf("expected EncodeError, got %v", err)
+		t.FailNow()
+	}
+	buf, err = encoder.AppendEncoded([]byte("page=1"), struct {
+		Name string      `qs:"name"`
+		BBox boundingBox `qs:"bbox"`
+	}{Name: "son", BBox: boundingBox{MinLat: 2, MaxLat: 1}})
+	if err == nil || string(buf) != "page=1" {
+		t.Errorf("expected error and unchanged dst, got %v, %s", err, buf)
+		t.FailNow()
+	}
+}
+
+func TestAppendEncodedAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops pooled encoders randomly with the race detector")
+	}
+	encoder := NewEncoder()
+
+	s := &struct {
+		Name  string   `qs:"name"`
+		Count int      `qs:"count"`
+		Tags  []string `qs:"tags"`
+	}{
+		Name:  "name",
+		Count: 12,
+		Tags:  []string{"a", "b"},
+	}
+	dst := make([]byte, 0, 128)
+	if _, err := encoder.AppendEncoded(dst, s); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, _ = encoder.AppendEncoded(dst[:0], s)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocation, got %v", allocs)
+		t.FailNow()
+	}
+}
+
+func TestEncodePairs(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder(WithSortedMapKeys())
+
+	type user struct {
+		Name string `qs:"name"`
+	}
+	s := struct {
+		Zeta   string         `qs:"zeta"`
+		Tags   []string       `qs:"tags"`
+		Users  []user         `qs:"users,index"`
+		Scores map[string]int `qs:"scores"`
+		Alpha  string         `qs:"alpha"`
+	}{
+		Zeta:   "z",
+		Tags:   []string{"b", "a"},
+		Users:  []user{{Name: "y"}, {Name: "x"}},
+		Scores: map[string]int{"c": 3, "a": 1, "b": 2},
+		Alpha:  "a b",
+	}
+	pairs, err := encoder.Pairs(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := Pairs{
+		{Key: "zeta", Value: "z"},
+		{Key: "tags", Value: "b"},
+		{Key: "tags", Value: "a"},
+		{Key: "users[0][name]", Value: "y"},
+		{Key: "users[1][name]", Value: "x"},
+		{Key: "scores[a]", Value: "1"},
+		{Key: "scores[b]", Value: "2"},
+		{Key: "scores[c]", Value: "3"},
+		{Key: "alpha", Value: "a b"},
+	}
+	if !reflect.DeepEqual(expected, pairs) {
+		t.Errorf("expected %v, got %v", expected, pairs)
+		t.FailNow()
+	}
+
+	query := "zeta=z&tags=b&tags=a&users%5B0%5D%5Bname%5D=y&users%5B1%5D%5Bname%5D=x" +
+		"&scores%5Ba%5D=1&scores%5Bb%5D=2&scores%5Bc%5D=3&alpha=a+b"
+	if pairs.Encode() != query {
+		t.Errorf("expected %s, got %s", query, pairs.Encode())
+		t.FailNow()
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(values, pairs.Values()) {
+		t.Errorf("expected %v, got %v", values, pairs.Values())
+		t.FailNow()
+	}
+
+	// Top-level maps are sorted as well
+	pairs, err = encoder.Pairs(map[string]int{"b": 2, "a": 1})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if pairs.Encode() != "a=1&b=2" {
+		t.Errorf("expected a=1&b=2, got %s", pairs.Encode())
+		t.FailNow()
+	}
+
+	_, err = encoder.Pairs(1)
+	if _, ok := err.(InvalidInputErr); !ok {
+		t.Errorf("expected InvalidInputErr, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestSortedMapKeys(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	s := struct {
+		Scores  map[string]int            `qs:"scores,sorted"`
+		Nested  map[int]map[string]string `qs:"nested,sorted"`
+		Filters []map[string]string       `qs:"filters,index,sorted"`
+		Iface   interface{}               `qs:"iface,sorted"`
+	}{
+		Scores:  map[string]int{"c": 3, "a": 1, "b": 2, "d": 4},
+		Nested:  map[int]map[string]string{10: {"y": "1", "x": "2"}, 2: {"z": "3"}},
+		Filters: []map[string]string{{"status": "open", "owner": "me"}},
+		Iface:   map[string]int{"z": 26, "m": 13},
+	}
+	expected := "scores%5Ba%5D=1&scores%5Bb%5D=2&scores%5Bc%5D=3&scores%5Bd%5D=4" +
+		"&nested%5B10%5D%5Bx%5D=2&nested%5B10%5D%5By%5D=1&nested%5B2%5D%5Bz%5D=3" +
+		"&filters%5B0%5D%5Bowner%5D=me&filters%5B0%5D%5Bstatus%5D=open" +
+		"&iface%5Bm%5D=13&iface%5Bz%5D=26"
+	// Map iteration order is random, encode several times
+	for i := 0; i < 20; i++ {
+		query, err := encoder.EncodeToString(s)
+		if err != nil {
+			t.Errorf("expected no error but got %v", err)
+			t.FailNow()
+		}
+		if query != expected {
+			t.Errorf("expected %s, got %s", expected, query)
+			t.FailNow()
+		}
+	}
+}
+
+func TestEncodeMapNotation(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	type user struct {
+		Name string `qs:"name"`
+	}
+	type filter struct {
+		Extra map[string]string `qs:"extra,flat"`
+		Tags  map[string]string `qs:"tags,colon"`
+	}
+	s := struct {
+		Bracket map[string]string `qs:"bracket"`
+		Dot     map[string]string `qs:"dot,dot"`
+		Colon   map[string]string `qs:"colon,colon"`
+		Flat    map[string]string `qs:"flat,flat"`
+		Users   map[string]user   `qs:"users,dot"`
+		Lists   map[string][]int  `qs:"lists,dot,index"`
+		Filter  filter            `qs:"filter,dot"`
+		Author  user              `qs:"author,colon"`
+		Inline  user              `qs:"inline,flat"`
+	}{
+		Bracket: map[string]string{"a": "1"},
+		Dot:     map[string]string{"b": "2"},
+		Colon:   map[string]string{"c": "3"},
+		Flat:    map[string]string{"d": "4"},
+		Users:   map[string]user{"admin": {Name: "son"}},
+		Lists:   map[string][]int{"l": {5}},
+		Filter: filter{
+			Extra: map[string]string{"e": "6"},
+			Tags:  map[string]string{"t": "7"},
+		},
+		Author: user{Name: "huynh"},
+		Inline: user{Name: "inline"},
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"bracket[a]":       []string{"1"},
+		"dot.b":            []string{"2"},
+		"colon:c":          []string{"3"},
+		"d":                []string{"4"},
+		"users.admin.name": []string{"son"},
+		"lists.l[0]":       []string{"5"},
+		"filter.e":         []string{"6"},
+		"filter.tags:t":    []string{"7"},
+		"author:name":      []string{"huynh"},
+		"name":             []string{"inline"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+func TestEncoderDefaultFormats(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder(WithArrayFormat(ArrayFormatComma), WithNestedFormat(NestedFormatDot))
+
+	type user struct {
+		Name  string   `qs:"name"`
+		Roles []string `qs:"roles"`
+	}
+	s := struct {
+		IDs     []int          `qs:"ids"`
+		Tags    []string       `qs:"tags,bracket"`
+		User    user           `qs:"user"`
+		Author  user           `qs:"author,bracket"`
+		Filter  map[string]int `qs:"filter"`
+		Facets  map[string]int `qs:"facets,colon"`
+		Indexed []int          `qs:"indexed,index"`
+	}{
+		IDs:     []int{1, 2},
+		Tags:    []string{"a", "b"},
+		User:    user{Name: "son", Roles: []string{"admin", "dev"}},
+		Author:  user{Name: "huynh"},
+		Filter:  map[string]int{"status": 1},
+		Facets:  map[string]int{"color": 2},
+		Indexed: []int{3},
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"ids":           []string{"1,2"},
+		"tags[]":        []string{"a", "b"},
+		"user.name":     []string{"son"},
+		"user.roles":    []string{"admin,dev"},
+		"author[name]":  []string{"huynh"},
+		"author[roles]": []string{""},
+		"filter.status": []string{"1"},
+		"facets:color":  []string{"2"},
+		"indexed[0]":    []string{"3"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+func TestEncodeListDelimiters(t *testing.T) {
+	t.Parallel()
+
+	type query struct {
+		Comma     []string `qs:"comma,comma"`
+		Space     []string `qs:"space,space"`
+		Pipe      []int    `qs:"pipe,pipe"`
+		Semicolon []string `qs:"semicolon,delim=;"`
+		Tab       []string `qs:"tab,delim=\\t"`
+	}
+	s := query{
+		Comma:     []string{"a", "b"},
+		Space:     []string{"a", "b"},
+		Pipe:      []int{1, 2, 3},
+		Semicolon: []string{"a", "b"},
+		Tab:       []string{"a", "b"},
+	}
+	values, err := NewEncoder().Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"comma":     []string{"a,b"},
+		"space":     []string{"a b"},
+		"pipe":      []string{"1|2|3"},
+		"semicolon": []string{"a;b"},
+		"tab":       []string{"a\tb"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	// Elements containing the delimiter are kept, rejected or escaped depending on the policy
+	conflict := struct {
+		Tags []string `qs:"tags,pipe"`
+	}{
+		Tags: []string{"a|b", "c%d"},
+	}
+	values, err = NewEncoder().Values(conflict)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if got := values.Get("tags"); got != "a|b|c%d" {
+		t.Errorf("expected %q, got %q", "a|b|c%d", got)
+		t.FailNow()
+	}
+
+	_, err = NewEncoder(WithDelimiterPolicy(DelimiterError)).Values(conflict)
+	var encodeErr EncodeError
+	if !errors.As(err, &encodeErr) || encodeErr.Path != "Tags[0]" || !errors.Is(err, ErrDelimiterInElement) {
+		t.Errorf("expected delimiter error of field Tags[0] but got %v", err)
+		t.FailNow()
+	}
+
+	values, err = NewEncoder(WithDelimiterPolicy(DelimiterEscape)).Values(conflict)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if got := values.Get("tags"); got != "a%7Cb|c%25d" {
+		t.Errorf("expected %q, got %q", "a%7Cb|c%25d", got)
+		t.FailNow()
+	}
+}
+
+type openAPIColor struct {
+	R int `qs:"R"`
+	G int `qs:"G"`
+	B int `qs:"B"`
+}
+
+type openAPIQuery struct {
+	IDs    []int             `qs:"id,style=form"`
+	CSV    []int             `qs:"csv,style=form,explode=false"`
+	Space  []int             `qs:"space,style=spaceDelimited"`
+	Pipe   []int             `qs:"pipe,style=pipeDelimited,explode=false"`
+	Deep   openAPIColor      `qs:"deep,style=deepObject"`
+	Joined openAPIColor      `qs:"joined,explode=false"`
+	Piped  *openAPIColor     `qs:"piped,style=pipeDelimited"`
+	Extra  map[string]string `qs:"extra,explode=true"`
+}
+
+func TestEncodeOpenAPIStyles(t *testing.T) {
+	t.Parallel()
+	// The style options win over the defaults of the encoder
+	encoder := NewEncoder(WithArrayFormat(ArrayFormatComma), WithNestedFormat(NestedFormatDot))
+
+	color := openAPIColor{R: 100, G: 200, B: 150}
+	s := openAPIQuery{
+		IDs:    []int{3, 4, 5},
+		CSV:    []int{3, 4, 5},
+		Space:  []int{3, 4, 5},
+		Pipe:   []int{3, 4, 5},
+		Deep:   color,
+		Joined: color,
+		Piped:  &color,
+		Extra:  map[string]string{"x": "1"},
+	}
+	values, err := encoder.Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"id":      []string{"3", "4", "5"},
+		"csv":     []string{"3,4,5"},
+		"space":   []string{"3 4 5"},
+		"pipe":    []string{"3|4|5"},
+		"deep[R]": []string{"100"},
+		"deep[G]": []string{"200"},
+		"deep[B]": []string{"150"},
+		"joined":  []string{"R,100,G,200,B,150"},
+		"piped":   []string{"R|100|G|200|B|150"},
+		"x":       []string{"1"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+func TestEncodeManyTagOptions(t *testing.T) {
+	t.Parallel()
+	s := struct {
+		IDs []int `qs:"ids,omitempty,style=form,explode=false,sorted,dot,colon"`
+	}{
+		IDs: []int{1, 2},
+	}
+	values, err := NewEncoder().Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{"ids": []string{"1,2"}}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
+
+type defaultQuery struct {
+	Limit int       `qs:"limit,default=20"`
+	Sort  string    `qs:"sort,omitempty,default=name"`
+	From  time.Time `qs:"from,second,default=1700000000"`
+	Tags  []string  `qs:"tags,default=a|b"`
+	Page  *int      `qs:"page,default=1"`
+	Size  uint      `qs:"size"`
+}
+
+func TestEncodeDefault(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	values, err := encoder.Values(defaultQuery{})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"limit": []string{"20"},
+		"sort":  []string{"name"},
+		"from":  []string{"1700000000"},
+		"tags":  []string{"a", "b"},
+		"page":  []string{"1"},
+		"size":  []string{"0"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	page := 3
+	values, err = encoder.Values(defaultQuery{Limit: 5, Sort: "date", From: time.Unix(1, 0), Tags: []string{"c"}, Page: &page, Size: 2})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected = url.Values{
+		"limit": []string{"5"},
+		"sort":  []string{"date"},
+		"from":  []string{"1"},
+		"tags":  []string{"c"},
+		"page":  []string{"3"},
+		"size":  []string{"2"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	// Malformed defaults are reported like malformed validation rules
+	_, err = encoder.Values(struct {
+		Bad  int  `qs:"bad,default=x"`
+		Page *int `qs:"page,omitempty,default=one"`
+	}{})
+	expectedErr := ValidationErrors{
+		{Path: "Bad", Key: "bad", Rule: "default=x"},
+		{Path: "Page", Key: "page", Rule: "default=one"},
+	}
+	if !reflect.DeepEqual(expectedErr, err) {
+		t.Errorf("expected %v, got %v", expectedErr, err)
+		t.FailNow()
+	}
+	// Malformed defaults are not used by set fields
+	values, err = encoder.Values(struct {
+		Bad int `qs:"bad,default=x"`
+	}{Bad: 1})
+	if err != nil || !reflect.DeepEqual(url.Values{"bad": {"1"}}, values) {
+		t.Errorf("expected bad=1 without error, got %v %v", values, err)
+		t.FailNow()
+	}
+
+	// Defaults are written in the time format of the encoder unless the field sets its own
+	type timeDefaults struct {
+		From time.Time `qs:"from,default=2020-01-02"`
+		To   time.Time `qs:"to,second,default=1700000000"`
+	}
+	values, err = NewEncoder(WithTimeLayout("date")).Values(timeDefaults{})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected = url.Values{"from": {"2020-01-02"}, "to": {"1700000000"}}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	// Defaults satisfy the validation rules
+	if _, err := encoder.Values(struct {
+		Limit int `qs:"limit,required,min=1,default=20"`
+	}{}); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestEncodeTextMarshalerPointerReceiver(t *testing.T) {
+	t.Parallel()
+	type query struct {
+		Value   big.Int     `qs:"value"`
+		Ptr     *big.Int    `qs:"ptr"`
+		List    []big.Int   `qs:"list"`
+		Dynamic interface{} `qs:"dynamic"`
+	}
+	s := query{
+		Value:   *big.NewInt(5),
+		Ptr:     big.NewInt(6),
+		List:    []big.Int{*big.NewInt(7), *big.NewInt(8)},
+		Dynamic: *big.NewInt(9),
+	}
+	values, err := NewEncoder().Values(s)
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{
+		"value":   []string{"5"},
+		"ptr":     []string{"6"},
+		"list":    []string{"7", "8"},
+		"dynamic": []string{"9"},
+	}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	var decoded query
+	if err := NewDecoder().Decode(values, &decoded); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	if decoded.Value.Int64() != 5 || decoded.Ptr.Int64() != 6 {
+		t.Errorf("expected 5 and 6, got %v and %v", &decoded.Value, decoded.Ptr)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,207 @@
+package qs
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// fieldRules holds the validation tag options of a struct field:
+// `required`, `min=`, `max=`, `maxlen=` and `oneof=a|b|c`
+type fieldRules struct {
+	required bool
+	// omitEmpty skips the other rules for zero values, which are not encoded
+	omitEmpty bool
+	rules     []validationRule
+	// malformed holds the defaults which can't be parsed, e.g. `default=x` of numbers,
+	// they are reported for nil and zero values which would be replaced by the default
+	malformed []string
+}
+
+type validationRule struct {
+	// option is the tag option, reported by ValidationError
+	option string
+	check  func(v reflect.Value) bool
+}
+
+// rulesFromOptions parses the validation rules of the tag options, it returns nil if there is none
+func rulesFromOptions(tagOptions [][]byte) *fieldRules {
+	var rules *fieldRules
+	omitEmpty := false
+	for _, tagOption := range tagOptions {
+		option := string(tagOption)
+		if option == tagOmitEmpty {
+			omitEmpty = true
+			continue
+		}
+		var check func(v reflect.Value) bool
+		switch {
+		case option == "required":
+			if rules == nil {
+				rules = &fieldRules{}
+			}
+			rules.required = true
+			continue
+		case strings.HasPrefix(option, "min="):
+			check = boundCheck(option[len("min="):], func(n float64, bound float64) bool { return n >= bound })
+		case strings.HasPrefix(option, "max="):
+			check = boundCheck(option[len("max="):], func(n float64, bound float64) bool { return n <= bound })
+		case strings.HasPrefix(option, "maxlen="):
+			check = maxLenCheck(option[len("maxlen="):])
+		case strings.HasPrefix(option, "oneof="):
+			check = oneOfCheck(strings.Split(option[len("oneof="):], "|"))
+		default:
+			continue
+		}
+		if rules == nil {
+			rules = &fieldRules{}
+		}
+		rules.rules = append(rules.rules, validationRule{option: option, check: check})
+	}
+	if rules != nil {
+		rules.omitEmpty = omitEmpty
+	}
+	return rules
+}
+
+// violated returns the options violated by v
+func (fieldRules *fieldRules) violated(v reflect.Value) []string {
+	var violated []string
+	if len(fieldRules.malformed) > 0 && isNilOrZero(v) {
+		violated = append(violated, fieldRules.malformed...)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if fieldRules.required {
+				return append(violated, "required")
+			}
+			return violated
+		}
+		v = v.Elem()
+	}
+
+	zero := isZeroValue(v)
+	if zero && fieldRules.required {
+		violated = append(violated, "required")
+	}
+	if zero && fieldRules.omitEmpty {
+		return violated
+	}
+	for _, rule := range fieldRules.rules {
+		if !rule.check(v) {
+			violated = append(violated, rule.option)
+		}
+	}
+	return violated
+}
+
+// isNilOrZero reports whether v is a nil pointer or interface, or points to a zero value
+func isNilOrZero(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return isZeroValue(v)
+}
+
+// isZeroValue reports whether v is zero, empty slices and maps are zero as well
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// boundCheck compares numbers with bound, and the length of strings, slices, arrays and maps
+func boundCheck(bound string, cmp func(n float64, bound float64) bool) func(v reflect.Value) bool {
+	boundNum, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		// malformed rules are always violated
+		return func(reflect.Value) bool { return false }
+	}
+	return func(v reflect.Value) bool {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return cmp(float64(v.Int()), boundNum)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return cmp(float64(v.Uint()), boundNum)
+		case reflect.Float32, reflect.Float64:
+			return cmp(v.Float(), boundNum)
+		case reflect.String:
+			return cmp(float64(utf8.RuneCountInString(v.String())), boundNum)
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return cmp(float64(v.Len()), boundNum)
+		default:
+			return false
+		}
+	}
+}
+
+// maxLenCheck limits the length of strings in characters, and of slices, arrays and maps
+func maxLenCheck(maxLen string) func(v reflect.Value) bool {
+	n, err := strconv.Atoi(maxLen)
+	if err != nil {
+		return func(reflect.Value) bool { return false }
+	}
+	return func(v reflect.Value) bool {
+		switch v.Kind() {
+		case reflect.String:
+			return utf8.RuneCountInString(v.String()) <= n
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return v.Len() <= n
+		default:
+			return false
+		}
+	}
+}
+
+// oneOfCheck accepts values formatted as one of values, every element of slices and arrays must match
+func oneOfCheck(values []string) func(v reflect.Value) bool {
+	var check func(v reflect.Value) bool
+	check = func(v reflect.Value) bool {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return true
+			}
+			v = v.Elem()
+		}
+		var str string
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				if !check(v.Index(i)) {
+					return false
+				}
+			}
+			return true
+		case reflect.String:
+			str = v.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			str = strconv.FormatInt(v.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			str = strconv.FormatUint(v.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			str = strconv.FormatFloat(v.Float(), 'f', -1, 64)
+		case reflect.Bool:
+			str = strconv.FormatBool(v.Bool())
+		default:
+			if !v.CanInterface() {
+				return false
+			}
+			str = fmt.Sprint(v.Interface())
+		}
+		for _, value := range values {
+			if str == value {
+				return true
+			}
+		}
+		return false
+	}
+	return check
+}
@@ -0,0 +1,134 @@
+package qs
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type validatedUser struct {
+	Name string `qs:"name,required,maxlen=5"`
+	Role string `qs:"role,oneof=admin|dev"`
+}
+
+type validatedQuery struct {
+	Limit  int             `qs:"limit,min=1,max=100"`
+	Page   *int            `qs:"page,required"`
+	Sort   string          `qs:"sort,omitempty,oneof=name|date"`
+	Tags   []string        `qs:"tags,maxlen=2,oneof=a|b|c"`
+	Score  float64         `qs:"score,omitempty,min=0.5"`
+	Owner  validatedUser   `qs:"owner"`
+	Users  []validatedUser `qs:"users,index"`
+	Filter map[string]int  `qs:"filter,required"`
+}
+
+func TestEncodeValidation(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+
+	page := 1
+	valid := validatedQuery{
+		Limit:  10,
+		Page:   &page,
+		Tags:   []string{"a", "c"},
+		Owner:  validatedUser{Name: "son", Role: "admin"},
+		Users:  []validatedUser{{Name: "huynh", Role: "dev"}},
+		Filter: map[string]int{"status": 1},
+	}
+	if _, err := encoder.Values(valid); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+
+	invalid := validatedQuery{
+		Limit:  101,
+		Sort:   "size",
+		Tags:   []string{"a", "d", "c"},
+		Owner:  validatedUser{Role: "guest"},
+		Users:  []validatedUser{{Name: "son"}, {Name: "nguyen"}},
+		Filter: map[string]int{},
+	}
+	_, err := encoder.Values(invalid)
+	var validationErrs ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		t.Errorf("expected validation errors but got %v", err)
+		t.FailNow()
+	}
+	expected := ValidationErrors{
+		{Path: "Limit", Key: "limit", Rule: "max=100"},
+		{Path: "Page", Key: "page", Rule: "required"},
+		{Path: "Sort", Key: "sort", Rule: "oneof=name|date"},
+		{Path: "Tags", Key: "tags", Rule: "maxlen=2"},
+		{Path: "Tags", Key: "tags", Rule: "oneof=a|b|c"},
+		{Path: "Owner.Name", Key: "owner[name]", Rule: "required"},
+		{Path: "Owner.Role", Key: "owner[role]", Rule: "oneof=admin|dev"},
+		{Path: "Users[0].Role", Key: "users[0][role]", Rule: "oneof=admin|dev"},
+		{Path: "Users[1].Name", Key: "users[1][name]", Rule: "maxlen=5"},
+		{Path: "Users[1].Role", Key: "users[1][role]", Rule: "oneof=admin|dev"},
+		{Path: "Filter", Key: "filter", Rule: "required"},
+	}
+	if !reflect.DeepEqual(expected, validationErrs) {
+		t.Errorf("expected %v, got %v", expected, validationErrs)
+		t.FailNow()
+	}
+}
+
+func TestEncodeValidationMalformedRule(t *testing.T) {
+	t.Parallel()
+	s := struct {
+		Limit int `qs:"limit,min=one"`
+	}{Limit: 1}
+	_, err := NewEncoder().Values(s)
+	expected := ValidationErrors{{Path: "Limit", Key: "limit", Rule: "min=one"}}
+	if !reflect.DeepEqual(expected, err) {
+		t.Errorf("expected %v, got %v", expected, err)
+		t.FailNow()
+	}
+}
+
+func TestEncodeValidationBeforeWriting(t *testing.T) {
+	t.Parallel()
+	encoder := NewEncoder()
+	s := struct {
+		A string `qs:"a"`
+		B int    `qs:"b,max=3"`
+		C string `qs:"c,required"`
+	}{A: "sent", B: 5}
+
+	values := url.Values{"sort": {"name"}}
+	err := encoder.Encode(s, values)
+	var validationErrs ValidationErrors
+	if !errors.As(err, &validationErrs) || len(validationErrs) != 2 {
+		t.Errorf("expected validation errors but got %v", err)
+		t.FailNow()
+	}
+	if expected := (url.Values{"sort": {"name"}}); !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := encoder.WriteMultipart(w, s); !errors.As(err, &validationErrs) {
+		t.Errorf("expected validation errors but got %v", err)
+		t.FailNow()
+	}
+	if body.Len() != 0 {
+		t.Errorf("expected nothing written, got %q", body.String())
+		t.FailNow()
+	}
+
+	s.B, s.C = 3, "set"
+	if err := encoder.Encode(s, values); err != nil {
+		t.Errorf("expected no error but got %v", err)
+		t.FailNow()
+	}
+	expected := url.Values{"sort": {"name"}, "a": {"sent"}, "b": {"3"}, "c": {"set"}}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("expected %v, got %v", expected, values)
+		t.FailNow()
+	}
+}
@@ -1,14 +1,158 @@
 package qs
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 )
 
+// ErrDelimiterInElement is returned when an element of a delimited list contains the delimiter
+// and the encoder is created with WithDelimiterPolicy(DelimiterError)
+var ErrDelimiterInElement = errors.New("list element contains the delimiter")
+
+// ErrFileInDelimitedValue is returned when a file would be joined into a delimited list or a styled object,
+// files can only be written as their own param
+var ErrFileInDelimitedValue = errors.New("file can't be encoded into a delimited value")
+
+// ConflictErr describes a key which is already in the query of a URL, see ConflictError
+type ConflictErr struct {
+	Key string
+}
+
+func (e ConflictErr) Error() string {
+	return fmt.Sprintf(`query param "%s" is already set`, e.Key)
+}
+
 type InvalidInputErr struct {
 	InputKind reflect.Kind
 }
 
 func (e InvalidInputErr) Error() string {
-	return fmt.Sprintf(`input should be struct type, got "%v"`, e.InputKind)
+	return fmt.Sprintf(`input should be struct or map type, got "%v"`, e.InputKind)
+}
+
+// InvalidDecodeInputErr describes an invalid input passed to Decoder.Decode
+type InvalidDecodeInputErr struct {
+	Type reflect.Type
+}
+
+func (e InvalidDecodeInputErr) Error() string {
+	if e.Type == nil {
+		return `input should be non-nil pointer to struct, got nil`
+	}
+	return fmt.Sprintf(`input should be non-nil pointer to struct, got "%v"`, e.Type)
+}
+
+// DecodeError describes a query value which could not be decoded into its field
+type DecodeError struct {
+	Key   string
+	Value string
+	Type  reflect.Type
+	Err   error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf(`cannot decode "%s" of key "%s" into "%v": %v`, e.Value, e.Key, e.Type, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError describes a struct field which could not be encoded
+type EncodeError struct {
+	// Path is the Go field path, e.g. Filter.Users[3].Since
+	Path string
+	// Key is the query key being produced
+	Key string
+	Err error
+}
+
+func (e EncodeError) Error() string {
+	return fmt.Sprintf(`cannot encode field "%s" of key "%s": %v`, e.Path, e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// wrapEncodeError prefixes the field path of err with path, wrapping err in an EncodeError if needed
+// keyFnc maps the key reported by the inner field to the key produced at the current level
+func wrapEncodeError(err error, path string, keyFnc func(key string) string) error {
+	if invalid, ok := err.(ValidationErrors); ok {
+		for i := range invalid {
+			invalid[i].Path = joinPath(path, invalid[i].Path)
+			if keyFnc != nil {
+				invalid[i].Key = keyFnc(invalid[i].Key)
+			}
+		}
+		return invalid
+	}
+	encodeErr, ok := err.(EncodeError)
+	if !ok {
+		encodeErr = EncodeError{Err: err}
+	}
+	encodeErr.Path = joinPath(path, encodeErr.Path)
+	if keyFnc != nil {
+		encodeErr.Key = keyFnc(encodeErr.Key)
+	}
+	return encodeErr
+}
+
+// joinPath prefixes the field path of an inner field with path
+func joinPath(path string, inner string) string {
+	switch {
+	case path == "":
+		return inner
+	case inner == "":
+		return path
+	case strings.HasPrefix(inner, "["):
+		return path + inner
+	default:
+		return path + "." + inner
+	}
+}
+
+// ValidationError describes a field violating one of its validation tag options
+type ValidationError struct {
+	// Path is the Go field path, e.g. Filter.Users[3].Name
+	Path string
+	// Key is the query key of the field
+	Key string
+	// Rule is the violated tag option, e.g. "max=100"
+	Rule string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf(`field "%s" of key "%s" violates "%s"`, e.Path, e.Key, e.Rule)
+}
+
+// ValidationErrors holds every validation error of an encoded value
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// errOrNil returns errs as an error, or nil if there is no validation error
+func (errs ValidationErrors) errOrNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// collectInvalid appends the validation errors held by err to invalid, other errors are returned
+func collectInvalid(invalid ValidationErrors, err error) (ValidationErrors, error) {
+	if errs, ok := err.(ValidationErrors); ok {
+		return append(invalid, errs...), nil
+	}
+	return invalid, err
 }
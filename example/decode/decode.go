@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/sonh/qs"
+)
+
+type User struct {
+	Verified bool   `qs:"verified"`
+	Name     string `qs:"name"`
+}
+
+type Query struct {
+	Tags  []string  `qs:"tags,comma"`
+	Limit int       `qs:"limit"`
+	From  time.Time `qs:"from,second"`
+	User  User      `qs:"user,dot"`
+}
+
+func main() {
+	values, err := url.ParseQuery("tags=foo,bar&limit=24&from=1580601600&user.verified=true&user.name=son")
+	if err != nil {
+		fmt.Println("failed")
+		return
+	}
+
+	decoder := qs.NewDecoder()
+
+	var query Query
+	if err = decoder.Decode(values, &query); err != nil {
+		// Handle error
+		fmt.Println("failed")
+		return
+	}
+	// output:
+	// {Tags:[foo bar] Limit:24 From:2020-02-02 00:00:00 +0000 UTC User:{Verified:true Name:son}}
+	fmt.Printf("%+v\n", query)
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package qs
+
+const raceEnabled = false
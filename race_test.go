@@ -0,0 +1,6 @@
+//go:build race
+
+package qs
+
+// raceEnabled reports whether tests run with the race detector, which disables sync.Pool reuse
+const raceEnabled = true